@@ -0,0 +1,181 @@
+package groupcache
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	// BreakerClosed 关闭状态，请求正常放行
+	BreakerClosed BreakerState = iota
+	// BreakerOpen 打开状态，请求直接被拒绝，不会发往远程节点
+	BreakerOpen
+	// BreakerHalfOpen 半开状态，只放行少量探测请求，用来判断远程节点是否恢复
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig 熔断器配置，字段为零值时使用 DefaultBreakerConfig 中对应的值
+type BreakerConfig struct {
+	// FailureThreshold 连续失败多少次后熔断
+	FailureThreshold int
+	// OpenTimeout 熔断后经过多久进入半开状态
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests 半开状态下允许同时通过的探测请求数，
+	// 同时也是恢复到关闭状态所需的连续成功次数
+	HalfOpenMaxRequests int
+}
+
+// DefaultBreakerConfig 默认的熔断器配置
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold:    5,
+	OpenTimeout:         10 * time.Second,
+	HalfOpenMaxRequests: 1,
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = DefaultBreakerConfig.FailureThreshold
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = DefaultBreakerConfig.OpenTimeout
+	}
+	if c.HalfOpenMaxRequests <= 0 {
+		c.HalfOpenMaxRequests = DefaultBreakerConfig.HalfOpenMaxRequests
+	}
+	return c
+}
+
+// BreakerStats 是某个熔断器在某一时刻的状态快照
+type BreakerStats struct {
+	State               BreakerState
+	ConsecutiveFailures int
+	Failures            int64     // 累计失败次数
+	Rejected            int64     // 因熔断而被直接拒绝的请求数
+	Trips               int64     // 进入打开状态的次数
+	OpenedAt            time.Time // 最近一次进入打开状态的时间
+}
+
+// circuitBreaker 是每个远程节点各自持有的熔断器
+//
+//	closed --(连续失败达到阈值)--> open --(经过 OpenTimeout)--> half-open
+//	half-open --(探测成功)--> closed
+//	half-open --(探测失败)--> open
+type circuitBreaker struct {
+	mu  sync.Mutex
+	cfg BreakerConfig
+	now func() time.Time // 方便测试时替换时钟
+
+	state            BreakerState
+	failures         int // 连续失败次数
+	openedAt         time.Time
+	halfOpenInFlight int // 半开状态下正在进行的探测请求数
+	halfOpenSuccess  int // 半开状态下连续成功的探测请求数
+
+	totalFailures int64
+	rejected      int64
+	trips         int64
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg.withDefaults(), now: time.Now}
+}
+
+// allow 判断当前请求能否发往远程节点，返回 true 时调用者必须在请求结束后调用
+// onSuccess 或 onFailure
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			b.rejected++
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.halfOpenInFlight = 0
+		b.halfOpenSuccess = 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.halfOpenInFlight >= b.cfg.HalfOpenMaxRequests {
+			b.rejected++
+			return false
+		}
+		b.halfOpenInFlight++
+	}
+	return true
+}
+
+func (b *circuitBreaker) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state == BreakerHalfOpen {
+		b.halfOpenInFlight--
+		b.halfOpenSuccess++
+		if b.halfOpenSuccess >= b.cfg.HalfOpenMaxRequests {
+			b.state = BreakerClosed
+		}
+	}
+}
+
+func (b *circuitBreaker) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.totalFailures++
+	b.failures++
+	switch b.state {
+	case BreakerHalfOpen:
+		// 探测失败，重新熔断
+		b.trip()
+	case BreakerClosed:
+		if b.failures >= b.cfg.FailureThreshold {
+			b.trip()
+		}
+	}
+}
+
+// trip 进入打开状态，调用者需持有 b.mu
+func (b *circuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.halfOpenInFlight = 0
+	b.halfOpenSuccess = 0
+	b.trips++
+}
+
+func (b *circuitBreaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	// 打开状态已经超时但还没有请求触发状态转换时，对外展示为半开
+	if state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		state = BreakerHalfOpen
+	}
+	return BreakerStats{
+		State:               state,
+		ConsecutiveFailures: b.failures,
+		Failures:            b.totalFailures,
+		Rejected:            b.rejected,
+		Trips:               b.trips,
+		OpenedAt:            b.openedAt,
+	}
+}
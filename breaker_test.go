@@ -0,0 +1,98 @@
+package groupcache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"void.io/x/cache/pb/cachepb"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("request %d should be allowed", i)
+		}
+		b.onFailure()
+	}
+	if s := b.stats(); s.State != BreakerOpen || s.Trips != 1 {
+		t.Fatalf("breaker should be open after 3 failures, got %+v", s)
+	}
+	if b.allow() {
+		t.Fatal("open breaker should reject requests")
+	}
+
+	// 超时后进入半开状态，只放行一个探测请求
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("half-open breaker should allow a probe")
+	}
+	if b.allow() {
+		t.Fatal("half-open breaker should allow only one probe at a time")
+	}
+	// 探测失败，重新熔断
+	b.onFailure()
+	if s := b.stats(); s.State != BreakerOpen || s.Trips != 2 {
+		t.Fatalf("failed probe should reopen the breaker, got %+v", s)
+	}
+
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("half-open breaker should allow a probe")
+	}
+	b.onSuccess()
+	if s := b.stats(); s.State != BreakerClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("successful probe should close the breaker, got %+v", s)
+	}
+}
+
+func TestHTTPGetterBreaker(t *testing.T) {
+	var hits, status int64 = 0, http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		http.Error(w, "boom", int(atomic.LoadInt64(&status)))
+	}))
+	defer srv.Close()
+
+	peer := strings.TrimPrefix(srv.URL, "http://")
+	pool := NewHTTPPool("127.0.0.1", "0",
+		WithBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}))
+	pool.Set(peer)
+	getter := pool.httpGetters[peer]
+
+	// not_found 等正常的结果说明远程节点可用，不会触发熔断
+	req := &cachepb.Request{Group: "g", Key: "k"}
+	for i := 0; i < 3; i++ {
+		if err := getter.Get(req, &cachepb.Response{}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: want not found, got %v", i, err)
+		}
+	}
+
+	// 500 说明远程节点出了问题，计入熔断器
+	atomic.StoreInt64(&status, http.StatusInternalServerError)
+	atomic.StoreInt64(&hits, 0)
+	for i := 0; i < 2; i++ {
+		if err := getter.Get(req, &cachepb.Response{}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: want server error, got %v", i, err)
+		}
+	}
+	if err := getter.Get(req, &cachepb.Response{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("want ErrCircuitOpen, got %v", err)
+	}
+	if n := atomic.LoadInt64(&hits); n != 2 {
+		t.Fatalf("open breaker should not reach the peer, hits = %d", n)
+	}
+
+	s := pool.Stats().Peers[peer]
+	if s.State != BreakerOpen || s.Rejected != 1 || s.Failures != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
@@ -0,0 +1,131 @@
+package groupcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// budgetDecayInterval 每隔多久将各个缓存的命中计数减半，使得评分更多反映最近的访问情况
+const budgetDecayInterval = 10 * time.Second
+
+// WithMinBytes 指定开启全局内存预算后，该 Group 至少可以保留多少字节的缓存，
+// 全局预算不足时不会从低于该值的 Group 中淘汰缓存
+func WithMinBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.mainCache.minBytes = n
+	}
+}
+
+// WithMaxBytes 指定该 Group 最多可以使用多少字节的缓存，会覆盖 NewGroup 的 size 参数
+func WithMaxBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.mainCache.size = n
+	}
+}
+
+// SetMemoryBudget 设置进程级的内存预算，所有 Group 的缓存共享这一预算，0 表示不限制。
+// 总用量超出预算时，会从边际命中价值（最近的命中次数 / 占用字节数）最低的 Group 中淘汰缓存，
+// 每个 Group 自身的容量上限（NewGroup 的 size 或 WithMaxBytes）以及 WithMinBytes 仍然有效
+func SetMemoryBudget(bytes int64) {
+	globalBudget.setLimit(bytes)
+}
+
+var globalBudget = &budget{caches: make(map[*cache]struct{})}
+
+// budget 是全局的内存预算协调者
+type budget struct {
+	limit int64 // 原子操作
+	total int64 // 所有缓存占用的字节数，由各个缓存在修改后更新，原子操作
+
+	mu        sync.Mutex
+	caches    map[*cache]struct{}
+	lastDecay time.Time
+}
+
+func (b *budget) register(c *cache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.caches[c] = struct{}{}
+	c.mu.Lock()
+	c.budget = b
+	c.reportLocked()
+	c.mu.Unlock()
+}
+
+func (b *budget) unregister(c *cache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.caches, c)
+	c.mu.Lock()
+	atomic.AddInt64(&b.total, -c.reported)
+	c.reported = 0
+	c.budget = nil
+	c.mu.Unlock()
+}
+
+func (b *budget) setLimit(bytes int64) {
+	atomic.StoreInt64(&b.limit, bytes)
+	b.reclaim()
+}
+
+// reclaim 在总用量超出预算时不断从评分最低的缓存中淘汰最久未使用的条目，
+// 调用者不能持有任何 cache 的锁。每次 Add 都会调用，没有超出预算时只读取两个原子变量
+func (b *budget) reclaim() {
+	limit := atomic.LoadInt64(&b.limit)
+	if limit <= 0 || atomic.LoadInt64(&b.total) <= limit {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	decay := time.Since(b.lastDecay) >= budgetDecayInterval
+	if decay {
+		b.lastDecay = time.Now()
+	}
+	var total int64
+	for c := range b.caches {
+		if decay {
+			atomic.StoreInt64(&c.hits, atomic.LoadInt64(&c.hits)/2)
+		}
+		total += c.bytes()
+	}
+
+	var exhausted map[*cache]bool // 再淘汰就会低于最小值的缓存
+	for total > limit {
+		victim := b.victimLocked(exhausted)
+		if victim == nil {
+			// 所有缓存都已经降到了最小值，无法继续淘汰
+			return
+		}
+		freed := victim.removeOldest(victim.minBytes)
+		if freed == 0 {
+			if exhausted == nil {
+				exhausted = make(map[*cache]bool)
+			}
+			exhausted[victim] = true
+			continue
+		}
+		total -= freed
+	}
+}
+
+// victimLocked 选出边际命中价值最低、且用量高于最小值的缓存，跳过 exhausted 中的缓存
+func (b *budget) victimLocked(exhausted map[*cache]bool) *cache {
+	var (
+		victim    *cache
+		bestScore float64
+	)
+	for c := range b.caches {
+		bytes := c.bytes()
+		if bytes == 0 || bytes <= c.minBytes || exhausted[c] {
+			continue
+		}
+		score := float64(atomic.LoadInt64(&c.hits)) / float64(bytes)
+		if victim == nil || score < bestScore {
+			victim, bestScore = c, score
+		}
+	}
+	return victim
+}
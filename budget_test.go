@@ -0,0 +1,78 @@
+package groupcache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	// 使用独立的预算，避免其他测试创建的 Group 参与淘汰
+	defer func(old *budget) { globalBudget = old }(globalBudget)
+	globalBudget = &budget{caches: make(map[*cache]struct{})}
+	SetMemoryBudget(2000)
+
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 90), nil
+	})
+	hot := NewGroup("budget-hot", 1<<20, getter)
+	cold := NewGroup("budget-cold", 1<<20, getter)
+	pinned := NewGroup("budget-pinned", 1<<20, getter, WithMinBytes(500), WithMaxBytes(600))
+
+	for i := 0; i < 10; i++ {
+		key := strconv.Itoa(i)
+		hot.Get(key)
+		cold.Get(key)
+		pinned.Get(key)
+		// hot 中的缓存被反复访问
+		for j := 0; j < 5; j++ {
+			hot.Get(key)
+		}
+	}
+
+	total := hot.mainCache.bytes() + cold.mainCache.bytes() + pinned.mainCache.bytes()
+	if total > 2000 {
+		t.Fatalf("total bytes %d exceeds budget", total)
+	}
+	if hot.mainCache.bytes() <= cold.mainCache.bytes() {
+		t.Fatalf("cold group should be evicted first, hot %d, cold %d",
+			hot.mainCache.bytes(), cold.mainCache.bytes())
+	}
+	if b := pinned.mainCache.bytes(); b < 500 || b > 600 {
+		t.Fatalf("pinned group should keep between 500 and 600 bytes, got %d", b)
+	}
+
+	// 缩小预算后立即回收
+	SetMemoryBudget(1000)
+	total = hot.mainCache.bytes() + cold.mainCache.bytes() + pinned.mainCache.bytes()
+	if total > 1000 {
+		t.Fatalf("total bytes %d exceeds shrunk budget", total)
+	}
+}
+
+func TestMemoryBudgetTotal(t *testing.T) {
+	defer func(old *budget) { globalBudget = old }(globalBudget)
+	globalBudget = &budget{caches: make(map[*cache]struct{})}
+
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return make([]byte, 90), nil
+	})
+	r := NewRegistry()
+	a := r.NewGroup("budget-total-a", 1<<20, getter)
+	b := r.NewGroup("budget-total-b", 1<<20, getter)
+	for i := 0; i < 10; i++ {
+		a.Get(strconv.Itoa(i))
+		b.Get(strconv.Itoa(i))
+	}
+	a.Remove("0")
+
+	// 没有设置预算时也要维护总用量，设置预算后立即生效
+	want := a.mainCache.bytes() + b.mainCache.bytes()
+	if got := atomic.LoadInt64(&globalBudget.total); got != want {
+		t.Fatalf("total should track cache bytes, got %d, want %d", got, want)
+	}
+	a.Close()
+	if got := atomic.LoadInt64(&globalBudget.total); got != b.mainCache.bytes() {
+		t.Fatalf("closed group should be removed from the total, got %d", got)
+	}
+}
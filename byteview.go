@@ -1,8 +1,20 @@
 package groupcache
 
+import (
+	"sync/atomic"
+	"time"
+)
+
 // ByteView 保证了数据的只读
 type ByteView struct {
-	b []byte
+	hits    int64 // 自加载以来的命中次数，原子操作，放在第一个字段以保证 64 位对齐
+	b       []byte
+	e       time.Time // 过期时间，零值表示永不过期
+	stale   bool      // 是否为已过期、正在后台刷新的旧值
+	codec   string    // 压缩算法的名称，为空表示 b 没有被压缩
+	version uint64    // 版本号，每次写入都会增大
+
+	etag atomic.Value // valueETag 的缓存，string
 }
 
 func (b *ByteView) Len() int64 {
@@ -17,6 +29,31 @@ func (b *ByteView) ByteSlice() []byte {
 	return cloneBytes(b.b)
 }
 
+// Expire 返回过期时间，零值表示永不过期
+func (b *ByteView) Expire() time.Time {
+	return b.e
+}
+
+// Version 返回该值的版本号，用于 Group.CompareAndSet
+func (b *ByteView) Version() uint64 {
+	return b.version
+}
+
+// Stale 表示该值是否已经过期，过期的值只会在 stale window 内返回，同时会在后台刷新
+func (b *ByteView) Stale() bool {
+	return b.stale
+}
+
+// expired 判断在 now 时刻该值是否已经过期
+func (b *ByteView) expired(now time.Time) bool {
+	return !b.e.IsZero() && !now.Before(b.e)
+}
+
+// withStale 返回一个标记为 stale 的副本，缓存中的 ByteView 是共享的，不能直接修改
+func (b *ByteView) withStale() *ByteView {
+	return &ByteView{b: b.b, e: b.e, stale: true, codec: b.codec, version: b.version}
+}
+
 func cloneBytes(b []byte) []byte {
 	bb := make([]byte, len(b), len(b))
 	copy(bb, b)
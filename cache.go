@@ -2,6 +2,8 @@ package groupcache
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"void.io/x/cache/lru"
 )
@@ -11,11 +13,35 @@ type cache struct {
 	mu   sync.RWMutex
 	lru  *lru.LRU
 	size int64 // 缓存大小
+
+	// onEvicted 在缓存因为容量不足被淘汰时调用，调用时不持有 mu，所以可以做耗时的操作（比如写磁盘），
+	// 容量不足时会优先淘汰 graced 中的缓存，此时 reason 为 EvictExpired
+	onEvicted func(key string, value *ByteView, reason EvictReason)
+	evicted   []evictedEntry // 持有锁期间被淘汰的缓存，释放锁后再回调 onEvicted
+	removing  bool           // 正在主动删除缓存，此时 lru 的淘汰回调不是因为容量不足
+	reason    EvictReason    // 当前 lru 淘汰回调的原因
+
+	graced map[string]struct{} // 已经过期、只在数据源失败时才会使用的缓存，容量不足时优先淘汰
+	// 所有缓存中最早的过期时间，零值表示没有会过期的缓存。删除缓存时不更新，所以可能早于实际的值，
+	// 容量不足时只有该时间已经过去才需要查找已经过期的缓存
+	minExpire time.Time
+
+	budget   *budget // 全局内存预算，为 nil 表示不参与
+	reported int64   // 已经计入 budget.total 的字节数，持有 mu 时修改
+	minBytes int64   // 全局预算不足时至少保留的字节数
+	hits     int64   // 最近的命中次数，原子操作，全局预算据此选择淘汰哪个缓存
+}
+
+type evictedEntry struct {
+	key    string
+	value  *ByteView
+	reason EvictReason
 }
 
 func (c *cache) get(key string) (value *ByteView, exist bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	// lru.Get 会移动链表节点，所以这里不能用读锁
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	if c.lru == nil {
 		return &ByteView{}, false
@@ -23,19 +49,234 @@ func (c *cache) get(key string) (value *ByteView, exist bool) {
 
 	v, exist := c.lru.Get(key)
 	if exist {
+		atomic.AddInt64(&c.hits, 1)
 		return v.(*ByteView), true
 	}
 
 	return nil, false
 }
 
+// peek 与 get 相同，但不计入命中次数
+func (c *cache) peek(key string) (*ByteView, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil, false
+	}
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*ByteView), true
+}
+
 func (c *cache) Add(key string, value *ByteView) {
+	c.addIf(key, value, nil)
+}
+
+// addIf 与 Add 相同，但只有 cond 为 nil 或者返回 true 时才会添加，cond 在持有 mu 时调用，返回是否添加
+func (c *cache) addIf(key string, value *ByteView, cond func() bool) bool {
+	c.mu.Lock()
+	if cond != nil && !cond() {
+		c.mu.Unlock()
+		return false
+	}
+	if c.lru == nil {
+		c.lru = lru.New(c.size, c.lruEvicted)
+	}
+	delete(c.graced, key)
+	if c.size > 0 {
+		c.evictExpired(c.lru.Bytes() + int64(len(key)) + value.Len() - c.size)
+	}
+	if !value.e.IsZero() && (c.minExpire.IsZero() || value.e.Before(c.minExpire)) {
+		c.minExpire = value.e
+	}
+	c.lru.Add(key, value)
+	c.reportLocked()
+	evicted, b := c.evicted, c.budget
+	c.evicted = nil
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	if b != nil {
+		b.reclaim()
+	}
+	return true
+}
+
+// reportLocked 将占用字节数的变化计入全局预算的总用量，调用时持有 mu
+func (c *cache) reportLocked() {
+	if c.budget == nil {
+		return
+	}
+	var n int64
+	if c.lru != nil {
+		n = c.lru.Bytes()
+	}
+	atomic.AddInt64(&c.budget.total, n-c.reported)
+	c.reported = n
+}
+
+func (c *cache) notifyEvicted(evicted []evictedEntry) {
+	if c.onEvicted != nil {
+		for _, e := range evicted {
+			c.onEvicted(e.key, e.value, e.reason)
+		}
+	}
+}
+
+// removeOldest 淘汰最久未使用的缓存（优先淘汰 graced 中的以及已经过期的缓存），返回释放的字节数，
+// 淘汰后占用的字节数会低于 floor 时不淘汰（graced 中的以及已经过期的缓存除外）
+func (c *cache) removeOldest(floor int64) int64 {
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return 0
+	}
+	before := c.lru.Bytes()
+	if c.evictExpired(1); c.lru.Bytes() == before {
+		var size int64
+		c.lru.Range(func(key string, value lru.Value) bool {
+			size = int64(len(key)) + value.Len()
+			return false
+		})
+		if before-size >= floor {
+			c.lru.RemoveOldest()
+		}
+	}
+	freed := before - c.lru.Bytes()
+	c.reportLocked()
+	evicted := c.evicted
+	c.evicted = nil
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return freed
+}
+
+// bytes 返回当前占用的字节数
+func (c *cache) bytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.Bytes()
+}
+
+// lruEvicted 是 lru 的淘汰回调，调用时持有 mu
+func (c *cache) lruEvicted(key string, value lru.Value) {
+	delete(c.graced, key)
+	if c.removing || c.onEvicted == nil {
+		return
+	}
+	c.evicted = append(c.evicted, evictedEntry{key: key, value: value.(*ByteView), reason: c.reason})
+}
+
+// grace 将 key 标记为已经过期、只在数据源失败时才会使用的缓存
+func (c *cache) grace(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	if _, ok := c.lru.Get(key); ok {
+		if c.graced == nil {
+			c.graced = make(map[string]struct{})
+		}
+		c.graced[key] = struct{}{}
+	}
+}
+
+// evictExpired 淘汰 graced 中的缓存，以及已经过期、没有被读到的缓存（按照从最久未使用开始的顺序），
+// 直到释放了至少 need 字节或者没有可以淘汰的缓存，调用时持有 mu
+func (c *cache) evictExpired(need int64) {
+	for key := range c.graced {
+		if need <= 0 {
+			return
+		}
+		need -= c.evictLocked(key, EvictExpired)
+	}
+	now := time.Now()
+	if need <= 0 || c.minExpire.IsZero() || now.Before(c.minExpire) {
+		return
+	}
+	// 遍历所有缓存，同时重新计算没有被淘汰的缓存中最早的过期时间
+	type entry struct {
+		key    string
+		expire time.Time
+	}
+	var expired []entry
+	var next time.Time
+	c.lru.Range(func(key string, value lru.Value) bool {
+		val := value.(*ByteView)
+		if val.expired(now) {
+			expired = append(expired, entry{key, val.e})
+		} else if !val.e.IsZero() && (next.IsZero() || val.e.Before(next)) {
+			next = val.e
+		}
+		return true
+	})
+	for _, e := range expired {
+		if need <= 0 {
+			// 还有没有被淘汰的过期缓存，下次容量不足时继续淘汰
+			if next.IsZero() || e.expire.Before(next) {
+				next = e.expire
+			}
+			continue
+		}
+		need -= c.evictLocked(e.key, EvictExpired)
+	}
+	c.minExpire = next
+}
+
+// evictLocked 以 reason 淘汰 key，返回释放的字节数，调用时持有 mu
+func (c *cache) evictLocked(key string, reason EvictReason) int64 {
+	before := c.lru.Bytes()
+	c.reason = reason
+	c.lru.Remove(key) // lruEvicted 会将 key 从 graced 中删除
+	c.reason = EvictCapacity
+	return before - c.lru.Bytes()
+}
+
+// remove 删除 key，返回 key 是否存在
+func (c *cache) remove(key string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.lru == nil {
-		c.lru = lru.New(c.size, nil)
+		return false
 	}
 
-	c.lru.Add(key, value)
+	before := c.lru.Len()
+	c.removing = true
+	c.lru.Remove(key)
+	c.removing = false
+	c.reportLocked()
+	return c.lru.Len() < before
+}
+
+// clear 丢弃所有缓存，不会触发 onEvicted
+func (c *cache) clear() {
+	c.mu.Lock()
+	c.lru = nil
+	c.evicted = nil
+	c.graced = nil
+	c.minExpire = time.Time{}
+	c.reportLocked()
+	b := c.budget
+	c.mu.Unlock()
+	if b != nil {
+		b.unregister(c)
+	}
+}
+
+// items 返回当前缓存的条目数
+func (c *cache) items() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return 0
+	}
+	return int64(c.lru.Len())
 }
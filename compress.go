@@ -0,0 +1,181 @@
+package groupcache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compressor 用于压缩缓存值，开启压缩后缓存中保存的是压缩后的数据（按照压缩后的大小计入缓存容量），
+// 节点之间传输的也是压缩后的数据，只有在返回给调用者时才会解压
+type Compressor interface {
+	// Name 是压缩算法的名称，节点之间通过它来协商压缩算法，必须全局唯一
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// MaxDecompressedSize 是解压后的最大字节数，超过时解压失败，
+// 避免远程节点发送的（或者磁盘上损坏的）压缩数据解压后耗尽内存。自定义的 Compressor 也应该遵守该限制
+var MaxDecompressedSize int64 = 64 << 20
+
+// ErrDecompressedTooLarge 表示解压后的数据超过了 MaxDecompressedSize
+var ErrDecompressedTooLarge = errors.New("groupcache: decompressed value too large")
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = make(map[string]Compressor)
+)
+
+func init() {
+	RegisterCompressor(Flate(flate.DefaultCompression))
+	RegisterCompressor(Gzip(gzip.DefaultCompression))
+}
+
+// RegisterCompressor 注册一个压缩算法，节点只能解压已经注册过的压缩算法压缩的数据，
+// 内置的 flate 和 gzip 已经默认注册
+func RegisterCompressor(c Compressor) {
+	if name := c.Name(); name == "" || len(name) > 255 {
+		panic("groupcache: compressor name must be 1 to 255 bytes")
+	}
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[c.Name()] = c
+}
+
+func getCompressor(name string) (Compressor, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+// registeredCodecs 返回所有已注册的压缩算法名称
+func registeredCodecs() []string {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	return names
+}
+
+// WithCompression 指定 Group 使用的压缩算法，c 会同时通过 RegisterCompressor 注册，
+// 以便解压当前节点以及其他节点使用 c 压缩的数据
+func WithCompression(c Compressor) GroupOption {
+	return func(g *Group) {
+		RegisterCompressor(c)
+		g.compressor = c
+	}
+}
+
+type flateCompressor struct{ level int }
+
+// Flate 返回使用 compress/flate 的压缩算法，level 见 flate.NewWriter
+func Flate(level int) Compressor {
+	return flateCompressor{level: level}
+}
+
+func (flateCompressor) Name() string { return "flate" }
+
+func (c flateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readLimited(r)
+}
+
+type gzipCompressor struct{ level int }
+
+// Gzip 返回使用 compress/gzip 的压缩算法，level 见 gzip.NewWriterLevel
+func Gzip(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (c gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// readLimited 读取 r 中的所有数据，超过 MaxDecompressedSize 时返回 ErrDecompressedTooLarge
+func readLimited(r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > MaxDecompressedSize {
+		return nil, ErrDecompressedTooLarge
+	}
+	return b, nil
+}
+
+// compress 按照 Group 的压缩配置压缩 val，压缩后没有变小时保留原始数据
+func (g *Group) compress(val *ByteView) *ByteView {
+	if g.compressor == nil || val.codec != "" {
+		return val
+	}
+	b, err := g.compressor.Compress(val.b)
+	if err != nil || len(b) >= len(val.b) {
+		return val
+	}
+	return &ByteView{b: b, e: val.e, stale: val.stale, codec: g.compressor.Name(), version: val.version}
+}
+
+// decompress 返回 val 解压后的 ByteView，val 没有被压缩时直接返回
+func decompress(val *ByteView) (*ByteView, error) {
+	if val.codec == "" {
+		return val, nil
+	}
+	c, ok := getCompressor(val.codec)
+	if !ok {
+		return nil, fmt.Errorf("groupcache: unknown compressor %q", val.codec)
+	}
+	b, err := c.Decompress(val.b)
+	if err == nil && int64(len(b)) > MaxDecompressedSize {
+		err = ErrDecompressedTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("groupcache: decompress with %v: %w", val.codec, err)
+	}
+	return &ByteView{b: b, e: val.e, stale: val.stale, version: val.version}, nil
+}
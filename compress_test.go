@@ -0,0 +1,115 @@
+package groupcache
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"void.io/x/cache/pb/cachepb"
+)
+
+var jsonBlob = []byte(strings.Repeat(`{"name":"Tom","score":630},`, 100))
+
+func TestCompression(t *testing.T) {
+	for _, c := range []Compressor{Flate(-1), Gzip(-1)} {
+		group := NewGroup("compress-"+c.Name(), 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			return jsonBlob, nil
+		}), WithCompression(c))
+
+		for i := 0; i < 2; i++ {
+			val, err := group.Get("k")
+			if err != nil || !bytes.Equal(val.ByteSlice(), jsonBlob) {
+				t.Fatalf("%v: get should return the original value, err: %v", c.Name(), err)
+			}
+		}
+		stored, _ := group.mainCache.get(cacheKey(0, "k"))
+		if stored.codec != c.Name() || stored.Len() >= int64(len(jsonBlob))/5 {
+			t.Fatalf("%v: cache should hold the compressed value, codec %q, len %d",
+				c.Name(), stored.codec, stored.Len())
+		}
+	}
+}
+
+// halfCompressor 是一个没有预先注册的压缩算法，由两个相同的半段组成的数据只保留前一半
+type halfCompressor struct{}
+
+func (halfCompressor) Name() string { return "test-half" }
+
+func (halfCompressor) Compress(src []byte) ([]byte, error) {
+	half := len(src) / 2
+	if len(src)%2 != 0 || !bytes.Equal(src[:half], src[half:]) {
+		return src, nil
+	}
+	return cloneBytes(src[:half]), nil
+}
+
+func (halfCompressor) Decompress(src []byte) ([]byte, error) {
+	return append(cloneBytes(src), src...), nil
+}
+
+func TestCustomCompression(t *testing.T) {
+	value := bytes.Repeat([]byte("ab"), 64)
+	group := NewRegistry().NewGroup("compress-custom", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return value, nil
+	}), WithCompression(halfCompressor{}))
+
+	for i := 0; i < 2; i++ {
+		val, err := group.Get("k")
+		if err != nil || !bytes.Equal(val.ByteSlice(), value) {
+			t.Fatalf("get %d should return the original value, got %q, err: %v", i, val, err)
+		}
+	}
+	if stored, _ := group.mainCache.get(cacheKey(0, "k")); stored.codec != "test-half" {
+		t.Fatalf("cache should hold the compressed value, codec %q", stored.codec)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	old := MaxDecompressedSize
+	MaxDecompressedSize = 1 << 10
+	defer func() { MaxDecompressedSize = old }()
+
+	for _, c := range []Compressor{Flate(-1), Gzip(-1)} {
+		bomb, err := c.Compress(make([]byte, 1<<20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decompress(&ByteView{b: bomb, codec: c.Name()}); !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Fatalf("%v: want ErrDecompressedTooLarge, got %v", c.Name(), err)
+		}
+	}
+}
+
+func TestCompressionOnWire(t *testing.T) {
+	NewGroup("compress-wire", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return jsonBlob, nil
+	}), WithCompression(Gzip(-1)))
+	srv := httptest.NewServer(NewHTTPPool("127.0.0.1", "0"))
+	defer srv.Close()
+	getter := &httpGetter{host: strings.TrimPrefix(srv.URL, "http://")}
+
+	// 请求方支持 gzip 时，传输的是压缩后的数据
+	resp := &cachepb.Response{}
+	err := getter.Get(&cachepb.Request{Group: "compress-wire", Key: "k", AcceptCodecs: []string{"gzip"}}, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Codec != "gzip" || len(resp.Value) >= len(jsonBlob) {
+		t.Fatalf("want gzip value on the wire, got codec %q, len %d", resp.Codec, len(resp.Value))
+	}
+	val, err := decompress(&ByteView{b: resp.Value, codec: resp.Codec})
+	if err != nil || !bytes.Equal(val.b, jsonBlob) {
+		t.Fatalf("decompress wire value: %v", err)
+	}
+
+	// 不支持时，对方会先解压
+	resp = &cachepb.Response{}
+	if err := getter.Get(&cachepb.Request{Group: "compress-wire", Key: "k"}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Codec != "" || !bytes.Equal(resp.Value, jsonBlob) {
+		t.Fatalf("want plain value, got codec %q", resp.Codec)
+	}
+}
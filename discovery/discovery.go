@@ -0,0 +1,65 @@
+// Package discovery 提供了 groupcache.Discovery 的内置实现：
+// 通过轮询 DNS SRV/A 记录发现节点的 DNS，以及监听节点列表文件的 File
+package discovery
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// DefaultInterval 默认的轮询间隔
+const DefaultInterval = 10 * time.Second
+
+// poll 每隔 interval 调用一次 lookup，只有当节点集合发生变化时才会调用 update，
+// lookup 出错时保留上一次的结果，直到 ctx 被取消
+func poll(ctx context.Context, interval time.Duration,
+	lookup func(ctx context.Context) ([]string, error),
+	onErr func(err error),
+	update func(peers []string)) error {
+	var last []string
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		peers, err := lookup(ctx)
+		if err != nil {
+			onErr(err)
+		} else if peers = normalize(peers); last == nil || !equal(last, peers) {
+			last = peers
+			update(peers)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// normalize 对节点去重并排序，方便比较两次结果是否相同
+func normalize(peers []string) []string {
+	seen := make(map[string]struct{}, len(peers))
+	out := make([]string, 0, len(peers))
+	for _, p := range peers {
+		if _, ok := seen[p]; ok || p == "" {
+			continue
+		}
+		seen[p] = struct{}{}
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver 是 DNS 查询所需的方法，*net.Resolver 实现了该接口，测试时可以替换为假的实现
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+type DNSOption func(d *DNS)
+
+// WithSRV 使用 SRV 记录发现节点，节点端口取自 SRV 记录，
+// 查询的是 _<service>._<proto>.<name>，service 和 proto 都为空时直接查询 name
+func WithSRV(service, proto string) DNSOption {
+	return func(d *DNS) {
+		d.srv = true
+		d.service = service
+		d.proto = proto
+	}
+}
+
+// WithPort 指定通过 A/AAAA 记录发现节点时，节点监听的端口
+func WithPort(port string) DNSOption {
+	return func(d *DNS) {
+		d.port = port
+	}
+}
+
+// WithResolver 指定 DNS 解析器，默认为 net.DefaultResolver
+func WithResolver(r Resolver) DNSOption {
+	return func(d *DNS) {
+		d.resolver = r
+	}
+}
+
+// WithDNSInterval 指定轮询 DNS 的间隔
+func WithDNSInterval(interval time.Duration) DNSOption {
+	return func(d *DNS) {
+		d.interval = interval
+	}
+}
+
+// DNS 通过定时查询 DNS 记录来发现节点，默认查询 A/AAAA 记录，
+// 使用 WithSRV 后改为查询 SRV 记录
+type DNS struct {
+	name     string
+	srv      bool
+	service  string
+	proto    string
+	port     string
+	resolver Resolver
+	interval time.Duration
+}
+
+func NewDNS(name string, opts ...DNSOption) *DNS {
+	d := &DNS{name: name}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.resolver == nil {
+		d.resolver = net.DefaultResolver
+	}
+	if d.interval <= 0 {
+		d.interval = DefaultInterval
+	}
+	return d
+}
+
+func (d *DNS) Watch(ctx context.Context, update func(peers []string)) error {
+	if !d.srv && d.port == "" {
+		return fmt.Errorf("discovery: port is required when using A records for %v", d.name)
+	}
+	return poll(ctx, d.interval, d.Lookup, func(err error) {
+		log.Printf("[discovery] dns lookup %v error: %v", d.name, err)
+	}, update)
+}
+
+// Lookup 查询一次 DNS，返回所有节点的地址，格式为 "host:port"
+func (d *DNS) Lookup(ctx context.Context) ([]string, error) {
+	if d.srv {
+		_, records, err := d.resolver.LookupSRV(ctx, d.service, d.proto, d.name)
+		if err != nil {
+			return nil, err
+		}
+		peers := make([]string, 0, len(records))
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			peers = append(peers, net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+		}
+		return peers, nil
+	}
+
+	hosts, err := d.resolver.LookupHost(ctx, d.name)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		peers = append(peers, net.JoinHostPort(host, d.port))
+	}
+	return peers, nil
+}
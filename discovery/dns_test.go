@@ -0,0 +1,104 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	srv   []*net.SRV
+	hosts []string
+	err   error
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return name, r.srv, r.err
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hosts, r.err
+}
+
+func (r *fakeResolver) set(fn func(r *fakeResolver)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r)
+}
+
+// watch 在后台运行 d.Watch，并把每次的节点列表发送到返回的 channel
+func watch(t *testing.T, d interface {
+	Watch(context.Context, func([]string)) error
+}) <-chan []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan []string, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Watch(ctx, func(peers []string) { ch <- peers })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return ch
+}
+
+func next(t *testing.T, ch <-chan []string) []string {
+	select {
+	case peers := <-ch:
+		return peers
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for peers update")
+		return nil
+	}
+}
+
+func TestDNSSRV(t *testing.T) {
+	r := &fakeResolver{srv: []*net.SRV{
+		{Target: "b.cache.local.", Port: 10002},
+		{Target: "a.cache.local.", Port: 10001},
+	}}
+	d := NewDNS("cache.local", WithSRV("groupcache", "tcp"),
+		WithResolver(r), WithDNSInterval(10*time.Millisecond))
+	ch := watch(t, d)
+
+	if got, want := next(t, ch), []string{"a.cache.local:10001", "b.cache.local:10002"}; !equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// 查询出错时保留上一次的结果，不会通知调用者
+	r.set(func(r *fakeResolver) { r.err = errors.New("dns down") })
+	time.Sleep(30 * time.Millisecond)
+	r.set(func(r *fakeResolver) {
+		r.err = nil
+		r.srv = append(r.srv, &net.SRV{Target: "c.cache.local.", Port: 10003})
+	})
+	if got := next(t, ch); len(got) != 3 || got[2] != "c.cache.local:10003" {
+		t.Fatalf("unexpected peers after scale out: %v", got)
+	}
+}
+
+func TestDNSA(t *testing.T) {
+	r := &fakeResolver{hosts: []string{"10.0.0.2", "10.0.0.1", "10.0.0.1"}}
+	d := NewDNS("cache.local", WithPort("8080"), WithResolver(r))
+	got, err := d.Lookup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := normalize(got), []string{"10.0.0.1:8080", "10.0.0.2:8080"}; !equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if err := NewDNS("cache.local").Watch(context.Background(), func([]string) {}); err == nil {
+		t.Fatal("A record discovery without a port should fail")
+	}
+}
@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+type FileOption func(f *File)
+
+// WithFileInterval 指定检查文件变化的间隔
+func WithFileInterval(interval time.Duration) FileOption {
+	return func(f *File) {
+		f.interval = interval
+	}
+}
+
+// File 通过监听一个节点列表文件来发现节点，文件内容支持两种格式：
+//   - JSON 字符串数组，e.g. ["127.0.0.1:10001", "127.0.0.1:10002"]
+//   - 纯文本，每行一个节点地址，忽略空行和以 '#' 开头的注释
+//
+// 文件被修改后，会在下一次检查时把新的节点列表通知给调用者
+type File struct {
+	path     string
+	interval time.Duration
+}
+
+func NewFile(path string, opts ...FileOption) *File {
+	f := &File{path: path}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.interval <= 0 {
+		f.interval = time.Second
+	}
+	return f
+}
+
+func (f *File) Watch(ctx context.Context, update func(peers []string)) error {
+	return poll(ctx, f.interval, func(context.Context) ([]string, error) {
+		return f.Read()
+	}, func(err error) {
+		log.Printf("[discovery] read peers file %v error: %v", f.path, err)
+	}, update)
+}
+
+// Read 读取并解析一次节点列表文件
+func (f *File) Read() ([]string, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePeers(data)
+}
+
+func parsePeers(data []byte) ([]string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var peers []string
+		if err := json.Unmarshal(data, &peers); err != nil {
+			return nil, err
+		}
+		return peers, nil
+	}
+
+	var peers []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		peers = append(peers, line)
+	}
+	return peers, scanner.Err()
+}
@@ -0,0 +1,27 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	if err := os.WriteFile(path, []byte("# cache nodes\n127.0.0.1:10002\n\n127.0.0.1:10001\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := watch(t, NewFile(path, WithFileInterval(10*time.Millisecond)))
+	if got, want := next(t, ch), []string{"127.0.0.1:10001", "127.0.0.1:10002"}; !equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`["127.0.0.1:10003", "127.0.0.1:10001"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := next(t, ch), []string{"127.0.0.1:10001", "127.0.0.1:10003"}; !equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
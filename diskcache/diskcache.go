@@ -0,0 +1,501 @@
+// Package diskcache 实现了一个基于本地磁盘的缓存，做为内存缓存之下的二级缓存：
+// 数据以追加写的方式写入段文件（segment），内存中只保存 key 到记录位置的索引，
+// 启动时通过扫描所有段文件重建索引，无效数据占比较高的段文件会被压缩（compaction）
+package diskcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 每条记录的格式（整数均为大端序）：
+//
+//	crc    uint32 之后所有字节的 CRC32（IEEE）
+//	flags  uint8  0 表示写入，1 表示删除（墓碑）
+//	keyLen uint32
+//	valLen uint32
+//	expire int64  过期时间，unix 纳秒时间戳，0 表示永不过期
+//	key    [keyLen]byte
+//	value  [valLen]byte
+const (
+	headerSize = 4 + 1 + 4 + 4 + 8
+
+	flagPut    = 0
+	flagDelete = 1
+
+	segmentExt = ".seg"
+)
+
+const (
+	// DefaultSegmentSize 默认的段文件大小，超过后会切换到新的段文件
+	DefaultSegmentSize = 64 << 20
+	// DefaultCompactRatio 段文件中有效数据占比低于该值时会被压缩
+	DefaultCompactRatio = 0.5
+)
+
+// ErrCorrupted 表示读取到的记录校验失败
+var ErrCorrupted = errors.New("diskcache: record corrupted")
+
+type Option func(s *Store)
+
+// WithSegmentSize 指定段文件大小
+func WithSegmentSize(size int64) Option {
+	return func(s *Store) {
+		s.segmentSize = size
+	}
+}
+
+// WithCompactRatio 指定压缩阈值，段文件中有效数据占比低于该值时会被压缩
+func WithCompactRatio(ratio float64) Option {
+	return func(s *Store) {
+		s.compactRatio = ratio
+	}
+}
+
+type segment struct {
+	id   uint64
+	f    *os.File
+	size int64 // 文件大小
+	live int64 // 有效记录的总大小
+}
+
+// location 是一条记录在段文件中的位置
+type location struct {
+	seg    uint64
+	offset int64
+	size   int64
+	expire int64
+}
+
+// Store 是磁盘缓存，并发安全
+type Store struct {
+	dir          string
+	maxBytes     int64 // 所有段文件的总大小上限，0 表示无限制
+	segmentSize  int64
+	compactRatio float64
+
+	mu       sync.Mutex
+	index    map[string]location
+	segments map[uint64]*segment
+	order    []uint64 // 按照从旧到新排列的段文件 id
+	active   *segment // 当前追加写的段文件
+
+	compacting bool // 压缩时也会追加写，避免在压缩过程中再次触发压缩
+}
+
+// Open 打开 dir 下的磁盘缓存，目录不存在时会创建，已有的段文件会被扫描以重建索引，
+// maxBytes 为磁盘占用的上限，超出后会丢弃最旧的段文件
+func Open(dir string, maxBytes int64, opts ...Option) (*Store, error) {
+	s := &Store{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentSize:  DefaultSegmentSize,
+		compactRatio: DefaultCompactRatio,
+		index:        make(map[string]location),
+		segments:     make(map[uint64]*segment),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	// 只能通过丢弃整个段文件来释放空间，所以段文件不能比预算大太多
+	if s.maxBytes > 0 && s.segmentSize > s.maxBytes/4 {
+		s.segmentSize = s.maxBytes / 4
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := s.loadSegment(id); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if n := len(s.order); n > 0 {
+		if last := s.segments[s.order[n-1]]; last.size < s.segmentSize {
+			s.active = last
+		}
+	}
+	if s.active == nil {
+		if err := s.rotate(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Dir 返回磁盘缓存所在的目录，目录中除段文件（.seg）以外的文件不会被 Store 读取或删除
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+func (s *Store) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// loadSegment 扫描段文件，用其中的记录更新索引，文件末尾不完整或者损坏的记录
+// （比如写入时进程崩溃）会被截断
+func (s *Store) loadSegment(id uint64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	seg := &segment{id: id, f: f}
+	s.segments[id] = seg
+	s.order = append(s.order, id)
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for {
+		flags, key, _, expire, size, err := readRecord(f, offset, info.Size(), false)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[diskcache] truncate segment %v at %v: %v", id, offset, err)
+				if err := f.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		s.unlinkLocked(key)
+		if flags == flagPut {
+			s.index[key] = location{seg: id, offset: offset, size: size, expire: expire}
+			seg.live += size
+		}
+		offset += size
+	}
+	seg.size = offset
+	return nil
+}
+
+// readRecord 读取 offset 处的记录，withValue 为 false 时只读取 key 以及校验。
+// fileSize 为文件大小，header 中的长度在校验之前不可信，超出文件末尾的记录视为不完整，不会按照它分配内存
+func readRecord(f *os.File, offset, fileSize int64, withValue bool) (flags byte, key string, value []byte, expire int64, size int64, err error) {
+	var header [headerSize]byte
+	if _, err = f.ReadAt(header[:], offset); err != nil {
+		if err == io.EOF {
+			// 读到了一部分 header，说明记录不完整
+			if n, _ := f.ReadAt(header[:1], offset); n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		return
+	}
+	flags = header[4]
+	keyLen := binary.BigEndian.Uint32(header[5:])
+	valLen := binary.BigEndian.Uint32(header[9:])
+	expire = int64(binary.BigEndian.Uint64(header[13:]))
+	size = headerSize + int64(keyLen) + int64(valLen)
+	if size > fileSize-offset {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+
+	body := make([]byte, int64(keyLen)+int64(valLen))
+	if _, err = f.ReadAt(body, offset+headerSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	if crc.Sum32() != binary.BigEndian.Uint32(header[:4]) {
+		err = ErrCorrupted
+		return
+	}
+	key = string(body[:keyLen])
+	if withValue {
+		value = body[keyLen:]
+	}
+	return
+}
+
+func encodeRecord(flags byte, key string, value []byte, expire int64) []byte {
+	b := make([]byte, headerSize+len(key)+len(value))
+	b[4] = flags
+	binary.BigEndian.PutUint32(b[5:], uint32(len(key)))
+	binary.BigEndian.PutUint32(b[9:], uint32(len(value)))
+	binary.BigEndian.PutUint64(b[13:], uint64(expire))
+	copy(b[headerSize:], key)
+	copy(b[headerSize+len(key):], value)
+	binary.BigEndian.PutUint32(b[:4], crc32.ChecksumIEEE(b[4:]))
+	return b
+}
+
+// rotate 创建一个新的段文件做为 active
+func (s *Store) rotate() error {
+	var id uint64 = 1
+	if n := len(s.order); n > 0 {
+		id = s.order[n-1] + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	seg := &segment{id: id, f: f}
+	s.segments[id] = seg
+	s.order = append(s.order, id)
+	s.active = seg
+	return nil
+}
+
+// appendLocked 向 active 段文件追加一条记录，写满后切换到新的段文件
+func (s *Store) appendLocked(flags byte, key string, value []byte, expire int64) (location, error) {
+	if s.active.size >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return location{}, err
+		}
+		s.compactLocked()
+	}
+	rec := encodeRecord(flags, key, value, expire)
+	seg := s.active
+	if _, err := seg.f.WriteAt(rec, seg.size); err != nil {
+		return location{}, err
+	}
+	loc := location{seg: seg.id, offset: seg.size, size: int64(len(rec)), expire: expire}
+	seg.size += loc.size
+	return loc, nil
+}
+
+// unlinkLocked 从索引中删除 key，并更新其所在段文件的有效数据大小
+func (s *Store) unlinkLocked(key string) {
+	if loc, ok := s.index[key]; ok {
+		if seg, ok := s.segments[loc.seg]; ok {
+			seg.live -= loc.size
+		}
+		delete(s.index, key)
+	}
+}
+
+// Put 写入一条缓存，expire 为零值表示永不过期
+func (s *Store) Put(key string, value []byte, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var e int64
+	if !expire.IsZero() {
+		e = expire.UnixNano()
+	}
+	loc, err := s.appendLocked(flagPut, key, value, e)
+	if err != nil {
+		return err
+	}
+	s.unlinkLocked(key)
+	s.index[key] = loc
+	s.segments[loc.seg].live += loc.size
+	s.enforceBudgetLocked()
+	return nil
+}
+
+// Get 读取一条缓存，已经过期的缓存同样会被返回，由调用者决定如何处理
+func (s *Store) Get(key string) (value []byte, expire time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc, exist := s.index[key]
+	if !exist {
+		return nil, time.Time{}, false
+	}
+	seg := s.segments[loc.seg]
+	_, k, v, e, _, err := readRecord(seg.f, loc.offset, seg.size, true)
+	if err != nil || k != key {
+		log.Printf("[diskcache] read key[%v] error: %v", key, err)
+		s.unlinkLocked(key)
+		return nil, time.Time{}, false
+	}
+	if e != 0 {
+		expire = time.Unix(0, e)
+	}
+	return v, expire, true
+}
+
+// Delete 删除一条缓存
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	s.unlinkLocked(key)
+	// 写入墓碑，保证重启后重建的索引中不会再出现该 key
+	_, err := s.appendLocked(flagDelete, key, nil, 0)
+	return err
+}
+
+// enforceBudgetLocked 磁盘占用超出上限时，丢弃最旧的段文件
+func (s *Store) enforceBudgetLocked() {
+	if s.maxBytes <= 0 {
+		return
+	}
+	for s.sizeLocked() > s.maxBytes && len(s.order) > 1 {
+		s.dropSegmentLocked(s.order[0])
+	}
+}
+
+func (s *Store) sizeLocked() int64 {
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	return size
+}
+
+// dropSegmentLocked 删除段文件以及索引中指向它的所有 key
+func (s *Store) dropSegmentLocked(id uint64) {
+	seg, ok := s.segments[id]
+	if !ok || seg == s.active {
+		return
+	}
+	for key, loc := range s.index {
+		if loc.seg == id {
+			delete(s.index, key)
+		}
+	}
+	seg.f.Close()
+	if err := os.Remove(s.segmentPath(id)); err != nil {
+		log.Printf("[diskcache] remove segment %v error: %v", id, err)
+	}
+	delete(s.segments, id)
+	for i, sid := range s.order {
+		if sid == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Compact 压缩所有有效数据占比低于阈值的段文件：把其中仍然有效的记录重新写入 active 段文件，
+// 然后删除旧的段文件。每次切换段文件时也会自动压缩
+func (s *Store) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compactLocked()
+}
+
+func (s *Store) compactLocked() {
+	if s.compacting {
+		return
+	}
+	s.compacting = true
+	defer func() { s.compacting = false }()
+
+	for _, id := range append([]uint64(nil), s.order...) {
+		seg := s.segments[id]
+		if seg == nil || seg == s.active || seg.size == 0 {
+			continue
+		}
+		if float64(seg.live)/float64(seg.size) >= s.compactRatio {
+			continue
+		}
+		if err := s.compactSegmentLocked(seg); err != nil {
+			log.Printf("[diskcache] compact segment %v error: %v", id, err)
+			return
+		}
+	}
+}
+
+func (s *Store) compactSegmentLocked(seg *segment) error {
+	// 比它更旧的段文件中可能还有被墓碑删除的 key，此时墓碑需要保留
+	hasOlder := len(s.order) > 0 && s.order[0] < seg.id
+
+	var offset int64
+	for offset < seg.size {
+		flags, key, value, expire, size, err := readRecord(seg.f, offset, seg.size, true)
+		if err != nil {
+			return err
+		}
+		loc, indexed := s.index[key]
+		switch {
+		case flags == flagPut && indexed && loc.seg == seg.id && loc.offset == offset:
+			newLoc, err := s.appendLocked(flags, key, value, expire)
+			if err != nil {
+				return err
+			}
+			seg.live -= loc.size
+			s.index[key] = newLoc
+			s.segments[newLoc.seg].live += newLoc.size
+		case flags == flagDelete && !indexed && hasOlder:
+			if _, err := s.appendLocked(flags, key, nil, 0); err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	s.dropSegmentLocked(seg.id)
+	return nil
+}
+
+// Stats 是磁盘缓存的统计信息
+type Stats struct {
+	Keys      int   // key 的数量
+	Segments  int   // 段文件数量
+	Bytes     int64 // 所有段文件的总大小
+	LiveBytes int64 // 有效记录的总大小
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := Stats{Keys: len(s.index), Segments: len(s.segments)}
+	for _, seg := range s.segments {
+		stats.Bytes += seg.size
+		stats.LiveBytes += seg.live
+	}
+	return stats
+}
+
+// Close 关闭所有段文件
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for _, seg := range s.segments {
+		if err := seg.f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,159 @@
+package diskcache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func mustOpen(t *testing.T, dir string, maxBytes int64, opts ...Option) *Store {
+	s, err := Open(dir, maxBytes, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s := mustOpen(t, dir, 0, WithSegmentSize(128))
+	expire := time.Now().Add(time.Hour).Round(0)
+	for i := 0; i < 10; i++ {
+		if err := s.Put(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i)), expire); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Put("key-1", []byte("updated"), time.Time{})
+	s.Delete("key-2")
+	s.Close()
+
+	// 重新打开后，通过扫描段文件重建索引
+	s = mustOpen(t, dir, 0, WithSegmentSize(128))
+	if v, e, ok := s.Get("key-0"); !ok || string(v) != "value-0" || !e.Equal(expire) {
+		t.Fatalf("key-0: %q %v %v", v, e, ok)
+	}
+	if v, e, ok := s.Get("key-1"); !ok || string(v) != "updated" || !e.IsZero() {
+		t.Fatalf("key-1 should be updated: %q %v %v", v, e, ok)
+	}
+	if _, _, ok := s.Get("key-2"); ok {
+		t.Fatal("key-2 should stay deleted after reopen")
+	}
+	if n := s.Stats().Keys; n != 9 {
+		t.Fatalf("want 9 keys, got %d", n)
+	}
+}
+
+func TestStoreTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	s := mustOpen(t, dir, 0)
+	s.Put("a", []byte("1"), time.Time{})
+	s.Put("b", []byte("2"), time.Time{})
+	s.Close()
+
+	// 模拟写入 b 时进程崩溃，只写了一半
+	path := s.segmentPath(1)
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s = mustOpen(t, dir, 0)
+	if _, _, ok := s.Get("a"); !ok {
+		t.Fatal("complete record should survive")
+	}
+	if _, _, ok := s.Get("b"); ok {
+		t.Fatal("truncated record should be dropped")
+	}
+	s.Put("c", []byte("3"), time.Time{})
+	if v, _, ok := s.Get("c"); !ok || string(v) != "3" {
+		t.Fatal("store should be writable after recovery")
+	}
+}
+
+func TestStoreCorruptedLength(t *testing.T) {
+	dir := t.TempDir()
+	s := mustOpen(t, dir, 0)
+	s.Put("a", []byte("1"), time.Time{})
+	s.Put("b", []byte("2"), time.Time{})
+	s.Close()
+
+	// 损坏 b 的 valLen，使其远大于文件，恢复时不应该按照它分配内存
+	path := s.segmentPath(1)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := int64(headerSize + 1 + 1)
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, offset+9); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s = mustOpen(t, dir, 0)
+	if _, _, ok := s.Get("a"); !ok {
+		t.Fatal("complete record should survive")
+	}
+	if _, _, ok := s.Get("b"); ok {
+		t.Fatal("record with a corrupted length should be dropped")
+	}
+	if info, _ := os.Stat(path); info.Size() != offset {
+		t.Fatalf("segment should be truncated to %d, got %d", offset, info.Size())
+	}
+}
+
+func TestStoreBudget(t *testing.T) {
+	s := mustOpen(t, t.TempDir(), 1024, WithSegmentSize(256))
+	for i := 0; i < 100; i++ {
+		s.Put(fmt.Sprintf("key-%03d", i), make([]byte, 32), time.Time{})
+	}
+	stats := s.Stats()
+	if stats.Bytes > 1024 {
+		t.Fatalf("disk usage %d exceeds budget", stats.Bytes)
+	}
+	if _, _, ok := s.Get("key-000"); ok {
+		t.Fatal("oldest key should be dropped")
+	}
+	if _, _, ok := s.Get("key-099"); !ok {
+		t.Fatal("newest key should be kept")
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s := mustOpen(t, dir, 0, WithSegmentSize(512))
+	for i := 0; i < 20; i++ {
+		s.Put(fmt.Sprintf("key-%d", i), make([]byte, 64), time.Time{})
+	}
+	// 覆盖写和删除后，旧的段文件中大部分数据都已经无效
+	for i := 0; i < 15; i++ {
+		s.Put(fmt.Sprintf("key-%d", i), []byte("new"), time.Time{})
+	}
+	for i := 15; i < 18; i++ {
+		s.Delete(fmt.Sprintf("key-%d", i))
+	}
+	before := s.Stats()
+	s.Compact()
+	after := s.Stats()
+	if after.Bytes >= before.Bytes {
+		t.Fatalf("compaction should reclaim space: before %+v, after %+v", before, after)
+	}
+
+	check := func(s *Store) {
+		for i := 0; i < 20; i++ {
+			v, _, ok := s.Get(fmt.Sprintf("key-%d", i))
+			switch {
+			case i < 15 && (!ok || string(v) != "new"):
+				t.Fatalf("key-%d: want new, got %q %v", i, v, ok)
+			case i >= 15 && i < 18 && ok:
+				t.Fatalf("key-%d should be deleted", i)
+			case i >= 18 && (!ok || len(v) != 64):
+				t.Fatalf("key-%d should be kept", i)
+			}
+		}
+	}
+	check(s)
+	s.Close()
+	check(mustOpen(t, dir, 0, WithSegmentSize(512)))
+}
@@ -0,0 +1,86 @@
+package groupcache
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"void.io/x/cache/diskcache"
+)
+
+// WithDiskTier 在 mainCache 之下增加一层磁盘缓存：因为容量不足被 mainCache 淘汰的缓存会写入 store，
+// Get 在 mainCache 未命中时会先查询 store，然后才去远程节点或者数据源获取
+func WithDiskTier(store *diskcache.Store) GroupOption {
+	return func(g *Group) {
+		g.diskTier = store
+	}
+}
+
+// spillToDisk 将被 mainCache 淘汰的缓存写入磁盘，ck 为带有 generation 的 key
+func (g *Group) spillToDisk(ck string, val *ByteView) {
+	if err := g.diskTier.Put(ck, encodeDiskValue(val), val.e); err != nil {
+		g.logger.Error("spill to disk failed", "group", g.name, "key", userKey(ck), "err", err)
+	}
+}
+
+// getFromDisk 从磁盘缓存中查找，找到后重新放回 mainCache
+func (g *Group) getFromDisk(ck string) (*ByteView, bool) {
+	epoch := g.invalidationEpoch(userKey(ck))
+	b, e, ok := g.diskTier.Get(ck)
+	if !ok {
+		return nil, false
+	}
+	val, err := decodeDiskValue(b)
+	if err != nil {
+		g.logger.Error("read from disk failed", "group", g.name, "key", userKey(ck), "err", err)
+		return nil, false
+	}
+	val.e = e
+	val.version = g.restoredVersion(val.version)
+	g.addLoaded(ck, epoch, val)
+	return val, true
+}
+
+// removeLocally 从 mainCache 和磁盘缓存中删除 ck（带有 generation 的 key），reason 为删除的原因
+func (g *Group) removeLocally(ck string, reason EvictReason) {
+	// 先增加失效纪元再删除，正在进行的加载要么不再添加结果，要么添加的结果被这里删除
+	g.bumpEpoch(userKey(ck))
+	removed := g.mainCache.remove(ck)
+	if g.diskTier != nil {
+		if err := g.diskTier.Delete(ck); err != nil {
+			g.logger.Error("delete from disk failed", "group", g.name, "key", userKey(ck), "err", err)
+		}
+	}
+	if removed && g.onEvict != nil {
+		g.onEvict(userKey(ck), reason)
+	}
+}
+
+// diskValueMarker 是磁盘值格式开头的标记，旧的格式以 codec 的长度开头，不会达到该值
+const diskValueMarker = 0xff
+
+// encodeDiskValue 将 val 编码为写入磁盘的格式：0xff | version uvarint | codecLen(1 byte) | codec | value，
+// 旧的格式没有开头的标记和版本号
+func encodeDiskValue(val *ByteView) []byte {
+	b := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+1+len(val.codec)+len(val.b))
+	b[0] = diskValueMarker
+	b = b[:1+binary.PutUvarint(b[1:], val.version)]
+	b = append(b, byte(len(val.codec)))
+	b = append(b, val.codec...)
+	return append(b, val.b...)
+}
+
+func decodeDiskValue(b []byte) (*ByteView, error) {
+	var version uint64
+	if len(b) > 0 && b[0] == diskValueMarker {
+		v, n := binary.Uvarint(b[1:])
+		if n <= 0 {
+			return nil, errors.New("groupcache: malformed disk value")
+		}
+		version, b = v, b[1+n:]
+	}
+	if len(b) == 0 || len(b) < 1+int(b[0]) {
+		return nil, errors.New("groupcache: malformed disk value")
+	}
+	n := int(b[0])
+	return &ByteView{b: b[1+n:], codec: string(b[1 : 1+n]), version: version}, nil
+}
@@ -0,0 +1,41 @@
+package groupcache
+
+import (
+	"strings"
+	"testing"
+
+	"void.io/x/cache/diskcache"
+)
+
+func TestDiskTier(t *testing.T) {
+	store, err := diskcache.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	loads := map[string]int{}
+	// mainCache 只能放下一个 key（key 长度 + value 长度 = 13）
+	group := NewGroup("disk-tier", 16, GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return []byte(strings.Repeat(key, 10)), nil
+	}), WithDiskTier(store))
+
+	group.Get("a")
+	group.Get("b") // a 被淘汰，写入磁盘
+	if _, _, ok := store.Get(cacheKey(0, "a")); !ok {
+		t.Fatal("evicted key should be spilled to disk")
+	}
+
+	val, err := group.Get("a")
+	if err != nil || val.String() != "aaaaaaaaaa" {
+		t.Fatalf("get from disk: %v, %v", val, err)
+	}
+	if loads["a"] != 1 {
+		t.Fatalf("key served from disk should not be loaded again, loads: %v", loads)
+	}
+	// a 重新回到了 mainCache
+	if _, ok := group.mainCache.get(cacheKey(0, "a")); !ok {
+		t.Fatal("key read from disk should be promoted to mainCache")
+	}
+}
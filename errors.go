@@ -0,0 +1,156 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"void.io/x/cache/pb/cachepb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotFound 表示数据源中不存在该 key，Getter 可以返回该错误（或者包装了该错误的错误），
+// 远程节点返回该错误时不会再从本地数据源加载
+var ErrNotFound = errors.New("groupcache: not found")
+
+// ErrGroupNotFound 表示不存在该名字的 Group，通常是远程节点上没有创建同名的 Group
+var ErrGroupNotFound = errors.New("groupcache: group not found")
+
+// ErrPeerUnavailable 表示远程节点不可用：网络错误、熔断器打开或者远程节点正在关闭
+var ErrPeerUnavailable = errors.New("groupcache: peer unavailable")
+
+// ErrLoadTimeout 表示加载超时：请求远程节点超时，或者 Getter 返回了 context.DeadlineExceeded
+var ErrLoadTimeout = errors.New("groupcache: load timeout")
+
+// ErrCircuitOpen 表示远程节点的熔断器处于打开状态，请求没有被发出
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker is open", ErrPeerUnavailable)
+
+// ErrGroupExists 表示同名的 Group 已经存在
+var ErrGroupExists = errors.New("groupcache: group already exists")
+
+// ErrGroupClosed 表示 Group 已经被关闭
+var ErrGroupClosed = errors.New("groupcache: group is closed")
+
+// 节点之间传递的错误码，对应 cachepb.Error 的 code 字段
+const (
+	codeNotFound        = "not_found"
+	codeGroupNotFound   = "group_not_found"
+	codePeerUnavailable = "peer_unavailable"
+	codeLoadTimeout     = "load_timeout"
+	codeLoadThrottled   = "load_throttled"
+	codeGroupClosed     = "group_closed"
+	codeVersionConflict = "version_conflict"
+	codeBadRequest      = "bad_request"
+	codeForbidden       = "forbidden"
+	codeInternal        = "internal"
+)
+
+// errorCodes 是错误、错误码与 HTTP 状态码的对应关系，
+// 从状态码推断错误码时使用同一状态码的第一项
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{ErrNotFound, codeNotFound, http.StatusNotFound},
+	{ErrGroupNotFound, codeGroupNotFound, http.StatusNotFound},
+	{ErrLoadTimeout, codeLoadTimeout, http.StatusGatewayTimeout},
+	{ErrLoadThrottled, codeLoadThrottled, http.StatusTooManyRequests},
+	{ErrPeerUnavailable, codePeerUnavailable, http.StatusServiceUnavailable},
+	{ErrGroupClosed, codeGroupClosed, http.StatusServiceUnavailable},
+	{ErrVersionConflict, codeVersionConflict, http.StatusConflict},
+	{nil, codeBadRequest, http.StatusBadRequest},
+	{nil, codeForbidden, http.StatusForbidden},
+}
+
+// errorCode 返回 err 对应的错误码和 HTTP 状态码，不认识的错误为 internal、500
+func errorCode(err error) (string, int) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codeLoadTimeout, http.StatusGatewayTimeout
+	}
+	for _, c := range errorCodes {
+		if c.err != nil && errors.Is(err, c.err) {
+			return c.code, c.status
+		}
+	}
+	return codeInternal, http.StatusInternalServerError
+}
+
+// PeerError 是请求远程节点失败时返回的错误，可以通过 errors.Is 判断是否为
+// ErrNotFound、ErrGroupNotFound、ErrPeerUnavailable、ErrLoadTimeout 等错误
+type PeerError struct {
+	Peer    string // 远程节点的地址
+	Code    string // 错误码，对应 cachepb.Error 的 code 字段
+	Status  int    // HTTP 状态码，请求没有得到响应时为 0
+	Message string // 远程节点返回的错误描述
+	Err     error  // 请求没有得到响应时的底层错误（例如网络错误），否则为 nil
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("groupcache: peer %v: %v (%v)", e.Peer, e.Message, e.Code)
+}
+
+// Is 根据错误码判断，使得 errors.Is(err, ErrNotFound) 等判断对远程节点返回的错误同样有效
+func (e *PeerError) Is(target error) bool {
+	for _, c := range errorCodes {
+		if c.err != nil && c.err == target && c.code == e.Code {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *PeerError) Unwrap() error {
+	return e.Err
+}
+
+// unavailableError 将请求远程节点时的网络错误转换为 PeerError，超时的错误码为 load_timeout
+func unavailableError(peer string, err error) *PeerError {
+	code := codePeerUnavailable
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		code = codeLoadTimeout
+	}
+	return &PeerError{Peer: peer, Code: code, Message: err.Error(), Err: err}
+}
+
+// writeError 将 err 写入响应：状态码由 errorCode 决定，响应体为只包含 error 的 cachepb.Response
+func writeError(w http.ResponseWriter, err error) {
+	code, status := errorCode(err)
+	writeErrorCode(w, code, status, err.Error())
+}
+
+func writeErrorCode(w http.ResponseWriter, code string, status int, message string) {
+	out := &cachepb.Response{Error: &cachepb.Error{Code: code, Message: message}}
+	body, err := proto.Marshal(out)
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// readError 将远程节点非 200 的响应转换为 PeerError，响应体不是 cachepb.Response 时
+// （例如远程节点是旧版本）根据状态码推断错误码
+func readError(peer string, res *http.Response, body []byte) *PeerError {
+	e := &PeerError{Peer: peer, Status: res.StatusCode}
+	out := &cachepb.Response{}
+	if proto.Unmarshal(body, out) == nil && out.Error != nil && out.Error.Code != "" {
+		e.Code, e.Message = out.Error.Code, out.Error.Message
+		return e
+	}
+	e.Code, e.Message = codeInternal, res.Status
+	for _, c := range errorCodes {
+		if c.status == res.StatusCode {
+			e.Code = c.code
+			break
+		}
+	}
+	return e
+}
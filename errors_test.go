@@ -0,0 +1,114 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"void.io/x/cache/pb/cachepb"
+)
+
+func TestPeerErrors(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, fmt.Errorf("user %v: %w", key, ErrNotFound)
+		case "slow":
+			return nil, context.DeadlineExceeded
+		case "boom":
+			return nil, errors.New("backend failure")
+		}
+		return []byte(key), nil
+	})
+	_, _, addr := startNode(t, "errors", getter)
+	peer := &httpGetter{host: addr}
+
+	tests := []struct {
+		group, key string
+		want       error
+		status     int
+		code       string
+	}{
+		{"errors", "missing", ErrNotFound, http.StatusNotFound, codeNotFound},
+		{"errors", "slow", ErrLoadTimeout, http.StatusGatewayTimeout, codeLoadTimeout},
+		{"nosuch", "k", ErrGroupNotFound, http.StatusNotFound, codeGroupNotFound},
+		{"errors", "boom", nil, http.StatusInternalServerError, codeInternal},
+	}
+	for _, tt := range tests {
+		err := peer.Get(&cachepb.Request{Group: tt.group, Key: tt.key}, &cachepb.Response{})
+		var pe *PeerError
+		if !errors.As(err, &pe) {
+			t.Fatalf("%v/%v: want *PeerError, got %T %v", tt.group, tt.key, err, err)
+		}
+		if pe.Status != tt.status || pe.Code != tt.code || pe.Peer != addr {
+			t.Fatalf("%v/%v: got %+v", tt.group, tt.key, pe)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Fatalf("%v/%v: want errors.Is %v, got %v", tt.group, tt.key, tt.want, err)
+		}
+		if errors.Is(err, ErrPeerUnavailable) {
+			t.Fatalf("%v/%v: should not be ErrPeerUnavailable", tt.group, tt.key)
+		}
+	}
+	if err := peer.Get(&cachepb.Request{Group: "errors", Key: "boom"}, &cachepb.Response{}); !strings.Contains(err.Error(), "backend failure") {
+		t.Fatalf("message of the peer should be kept, got %v", err)
+	}
+}
+
+func TestPeerUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	slow := &httpGetter{host: host, client: &http.Client{Timeout: 20 * time.Millisecond}}
+	err := slow.Get(&cachepb.Request{Group: "g", Key: "k"}, &cachepb.Response{})
+	if !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("want ErrLoadTimeout, got %v", err)
+	}
+
+	srv.Close()
+	down := &httpGetter{host: host}
+	err = down.Get(&cachepb.Request{Group: "g", Key: "k"}, &cachepb.Response{})
+	if !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("want ErrPeerUnavailable, got %v", err)
+	}
+	if !errors.Is(ErrCircuitOpen, ErrPeerUnavailable) {
+		t.Fatal("ErrCircuitOpen should be an ErrPeerUnavailable")
+	}
+}
+
+func TestNotFoundFromPeer(t *testing.T) {
+	loads := map[string]int{}
+	newGetter := func(name string) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			loads[name]++
+			return nil, ErrNotFound
+		})
+	}
+	a, poolA, addrA := startNode(t, "notfound", newGetter("a"))
+	_, poolB, addrB := startNode(t, "notfound", newGetter("b"))
+	poolA.Set(addrA, addrB)
+	poolB.Set(addrA, addrB)
+
+	key := "k"
+	for i := 0; poolA.peers.Get(key) != addrB; i++ {
+		key = fmt.Sprintf("k%d", i)
+	}
+	if _, err := a.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	// 远程节点确认不存在后，不再从本地数据源加载
+	if loads["a"] != 0 || loads["b"] != 1 {
+		t.Fatalf("want only the owner to load, got %v", loads)
+	}
+	if s := a.Stats(); s.PeerErrors != 0 {
+		t.Fatalf("not found is not a peer error, got %+v", s)
+	}
+}
@@ -0,0 +1,88 @@
+package groupcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// computeETag 根据响应的内容计算强 ETag，parts 依次写入哈希，相同的内容得到相同的 ETag
+func computeETag(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(strconv.Itoa(len(p))))
+		h.Write([]byte{':'})
+		h.Write(p)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// valueETag 是节点之间传递的 value 的 ETag，包括压缩算法和版本号：压缩过的值与没有压缩的值 ETag 不同，
+// 写入相同的内容也会得到新的 ETag，请求方不会因为 304 而保留旧的版本号。计算结果缓存在 ByteView 中
+func valueETag(val *ByteView) string {
+	if etag, ok := val.etag.Load().(string); ok {
+		return etag
+	}
+	etag := computeETag([]byte(val.codec), strconv.AppendUint(nil, val.version, 10), val.b)
+	val.etag.Store(etag)
+	return etag
+}
+
+// readETag 是 ReadHandler 响应的 ETag，由格式、value 的 ETag 以及响应中的其他元数据计算，
+// 不需要对整个响应体计算哈希
+func readETag(contentType string, val *ByteView, gen uint64) string {
+	meta := strconv.AppendInt(nil, val.e.UnixNano(), 10)
+	meta = strconv.AppendBool(append(meta, ':'), val.stale)
+	meta = strconv.AppendUint(append(meta, ':'), gen, 10)
+	return computeETag([]byte(contentType), []byte(valueETag(val)), meta)
+}
+
+// etagMatch 判断 If-None-Match 头是否与 etag 匹配，使用弱比较（忽略 W/ 前缀）
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl 根据值的剩余有效期计算 Cache-Control 头：没有过期时间的值可能随时被 Set 或者 Invalidate 修改，
+// 使用 no-cache 要求每次都重新验证；已经过期、正在后台刷新的旧值为 max-age=0
+func cacheControl(val *ByteView, now time.Time) string {
+	e := val.Expire()
+	if e.IsZero() {
+		return "no-cache"
+	}
+	if val.Stale() || !now.Before(e) {
+		return "max-age=0"
+	}
+	return "max-age=" + strconv.FormatInt(int64(e.Sub(now)/time.Second), 10)
+}
+
+// setCacheHeaders 设置 ETag 和 Cache-Control，请求的 If-None-Match 与 etag 匹配时返回 true，
+// 此时调用者应该返回 304 并且不发送响应体。已经过期的旧值不会返回 304，请求方会拿到完整的值和 stale 标记
+func setCacheHeaders(header http.Header, ifNoneMatch string, val *ByteView, etag string) bool {
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl(val, time.Now()))
+	return ifNoneMatch != "" && !val.Stale() && etagMatch(ifNoneMatch, etag)
+}
+
+// parseMaxAge 解析 Cache-Control 头中的 max-age，没有 max-age 时返回 false
+func parseMaxAge(cc string) (time.Duration, bool) {
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.TrimSpace(d)
+		if v := strings.TrimPrefix(d, "max-age="); v != d {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return 0, false
+			}
+			return time.Duration(n) * time.Second, true
+		}
+	}
+	return 0, false
+}
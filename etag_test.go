@@ -0,0 +1,165 @@
+package groupcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"void.io/x/cache/pb/cachepb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestConditionalGet(t *testing.T) {
+	_, _, addr := startNode(t, "etag", GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}), WithExpiration(time.Hour))
+	peer := &httpGetter{host: addr}
+
+	// 200 响应总是带有 ETag，请求方没有压缩算法时值没有被压缩，ETag 与本地计算的一致
+	res, err := http.Get("http://" + addr + defaultUrl + "etag/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	etag := res.Header.Get("ETag")
+	out := &cachepb.Response{}
+	if err := proto.Unmarshal(body, out); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %v, %v", res.Status, err)
+	}
+	if etag == "" || etag != valueETag(&ByteView{b: out.Value, version: out.Version}) {
+		t.Fatalf("want the ETag of the value on 200, got %q", etag)
+	}
+
+	out = &cachepb.Response{}
+	if err := peer.Get(&cachepb.Request{Group: "etag", Key: "a", IfNoneMatch: etag}, out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.NotModified || len(out.Value) != 0 {
+		t.Fatalf("want not modified without value, got %v", out)
+	}
+	if d := time.Until(time.Unix(0, out.Expire)); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("expire should follow max-age, got %v", d)
+	}
+
+	out = &cachepb.Response{}
+	if err := peer.Get(&cachepb.Request{Group: "etag", Key: "a", IfNoneMatch: `"other"`}, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.NotModified || string(out.Value) != "value of a" {
+		t.Fatalf("mismatched etag should return the value, got %v", out)
+	}
+
+	// 标准的 HTTP 客户端同样可以使用 ETag
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+defaultUrl+"etag/a", nil)
+	req.Header.Set("If-None-Match", etag)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotModified || res.Header.Get("ETag") != etag ||
+		!strings.HasPrefix(res.Header.Get("Cache-Control"), "max-age=") {
+		t.Fatalf("want 304 with cache headers, got %v %v", res.Status, res.Header)
+	}
+}
+
+func TestReadHandlerConditionalGet(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGroup("etag", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	h := NewReadHandler(WithReadRegistry(registry))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cache/etag/a", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("want ETag and no-cache for values without expiration, got %v", w.Header())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/cache/etag/a", nil)
+	r.Header.Set("If-None-Match", `"x", `+etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("want 304, got %v %q", w.Code, w.Body)
+	}
+
+	// 不同的格式 ETag 不同
+	r = httptest.NewRequest(http.MethodGet, "/cache/etag/a", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("json should have its own ETag, got %v %v", w.Code, w.Header())
+	}
+}
+
+func TestRevalidateFromPeer(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	})
+	remote := NewRegistry()
+	remote.NewGroup("revalidate", 1024, getter, WithExpiration(time.Hour))
+	srv := httptest.NewServer(NewHTTPPool("127.0.0.1", "0", WithRegistry(remote)))
+	defer srv.Close()
+
+	tracer := &memoryTracer{}
+	local := NewRegistry()
+	group := local.NewGroup("revalidate", 1024, getter, WithStaleWindow(time.Hour), WithTracer(tracer))
+	pool := NewHTTPPool("127.0.0.1", "0", WithRegistry(local))
+	pool.Set(strings.TrimPrefix(srv.URL, "http://"))
+	group.RegisterPeers(pool)
+
+	// revalidate 在本地放一个已经过期的副本，等待后台刷新完成后返回刷新后的值
+	ck := cacheKey(0, "a")
+	revalidate := func(version uint64) *ByteView {
+		t.Helper()
+		group.mainCache.Add(ck, &ByteView{b: []byte("value of a"), e: time.Now().Add(-time.Second), version: version})
+		val, err := group.Get("a")
+		if err != nil || !val.Stale() {
+			t.Fatalf("want stale value, got %v %v", val, err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if v, ok := group.mainCache.peek(ck); ok && !v.expired(time.Now()) {
+				if v.String() != "value of a" {
+					t.Fatalf("want the local value, got %q", v)
+				}
+				return v
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("local copy should be revalidated")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// 本地副本与远程节点的版本相同时，远程节点只需要返回 304
+	owner, err := remote.GetGroup("revalidate").Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revalidate(owner.Version())
+	peers := tracer.find("groupcache.getFromPeer")
+	if len(peers) != 1 || peers[0].attrs["not_modified"] != true {
+		t.Fatalf("revalidation should be answered with not modified, got %d spans", len(peers))
+	}
+
+	// 写入了相同的内容，版本号变了，需要拿到新的版本号
+	old := owner.Version()
+	if err := remote.GetGroup("revalidate").Set(context.Background(), "a", []byte("value of a")); err != nil {
+		t.Fatal(err)
+	}
+	owner, _ = remote.GetGroup("revalidate").Get("a")
+	if v := revalidate(old); owner.Version() == old || v.Version() != owner.Version() {
+		t.Fatalf("want the new version %d, got %d", owner.Version(), v.Version())
+	}
+}
@@ -0,0 +1,77 @@
+package groupcache
+
+import (
+	"strings"
+	"time"
+)
+
+// EvictReason 表示缓存被淘汰的原因
+type EvictReason int
+
+const (
+	// EvictCapacity 因为容量不足（Group 自身的容量或全局内存预算）被淘汰
+	EvictCapacity EvictReason = iota
+	// EvictExpired 因为过期被删除，或者处于 grace period 的缓存因为容量不足被淘汰
+	EvictExpired
+	// EvictRemoved 被 Group.Remove 主动删除
+	EvictRemoved
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// WithOnHit 注册缓存命中时的回调（包括命中了 stale window 内的旧值），
+// 回调在 Get 的调用方 goroutine 中同步执行，不应该做耗时的操作，下同
+func WithOnHit(fn func(key string)) GroupOption {
+	return func(g *Group) {
+		g.onHit = fn
+	}
+}
+
+// WithOnMiss 注册缓存未命中时的回调
+func WithOnMiss(fn func(key string)) GroupOption {
+	return func(g *Group) {
+		g.onMiss = fn
+	}
+}
+
+// WithOnLoad 注册加载完成时的回调，d 为从远程节点或数据源加载所花的时间，
+// 并发的同一个 key 的加载会被合并，只会回调一次
+func WithOnLoad(fn func(key string, d time.Duration, err error)) GroupOption {
+	return func(g *Group) {
+		g.onLoad = fn
+	}
+}
+
+// WithOnEvict 注册缓存被淘汰时的回调，Close 释放缓存时不会回调
+func WithOnEvict(fn func(key string, reason EvictReason)) GroupOption {
+	return func(g *Group) {
+		g.onEvict = fn
+	}
+}
+
+// Remove 从当前节点删除 key 的缓存（包括磁盘缓存），不会影响其他节点
+func (g *Group) Remove(key string) {
+	g.removeLocally(cacheKey(g.Generation(), key), EvictRemoved)
+}
+
+// cacheEvicted 是 mainCache 因为容量不足淘汰缓存时的回调，ck 为带有 generation 的 key
+func (g *Group) cacheEvicted(ck string, val *ByteView, reason EvictReason) {
+	// 已经过期的缓存，以及旧 generation 的缓存（已经无法访问）没有必要写入磁盘
+	if g.diskTier != nil && reason == EvictCapacity && strings.HasPrefix(ck, cacheKey(g.Generation(), "")) {
+		g.spillToDisk(ck, val)
+	}
+	if g.onEvict != nil {
+		g.onEvict(userKey(ck), reason)
+	}
+}
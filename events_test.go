@@ -0,0 +1,51 @@
+package groupcache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	var events []string
+	group := NewGroup("events", 30, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("no such key")
+		}
+		return []byte("0123456789"), nil
+	}),
+		WithExpiration(50*time.Millisecond),
+		WithOnHit(func(key string) { events = append(events, "hit "+key) }),
+		WithOnMiss(func(key string) { events = append(events, "miss "+key) }),
+		WithOnLoad(func(key string, d time.Duration, err error) {
+			events = append(events, fmt.Sprintf("load %v %v", key, err))
+		}),
+		WithOnEvict(func(key string, reason EvictReason) {
+			events = append(events, fmt.Sprintf("evict %v %v", key, reason))
+		}))
+	defer DeleteGroup("events")
+
+	group.Get("a")
+	group.Get("a")
+	group.Get("b")       // a 和 b 共占 22 字节
+	group.Get("c")       // 超出容量，淘汰 a
+	group.Get("missing") // 加载失败
+	group.Remove("b")
+	group.Remove("b") // 已经不存在，不会回调
+	time.Sleep(60 * time.Millisecond)
+	group.Get("c") // 已经过期
+
+	want := []string{
+		"miss a", "load a <nil>",
+		"hit a",
+		"miss b", "load b <nil>",
+		"miss c", "evict a capacity", "load c <nil>",
+		"miss missing", "load missing no such key",
+		"evict b removed",
+		"evict c expired", "miss c", "load c <nil>",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("unexpected events:\n got %q\nwant %q", events, want)
+	}
+}
@@ -0,0 +1,152 @@
+package groupcache
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 每个 Group 都有一个 generation，本地缓存中的 key 都带有 generation 前缀，
+// 节点之间的请求和响应也都带有 generation，收到更大的 generation 时会更新自己的 generation，
+// 所以只要增加 generation，所有旧的缓存就都不会再被访问到，之后由 LRU 慢慢淘汰。
+// generation 会随快照保存，启用磁盘缓存时也会写入磁盘缓存目录下单独的文件（不会被磁盘缓存淘汰），
+// 重启后不会回到 0 而重新读到旧的缓存
+
+// generationParam 是请求方告知对方 generation 的 query 参数
+const generationParam = "generation"
+
+// generationPath 是管理 generation 的路径：<baseURL>/_generation/<groupName>，
+// GET 返回当前的 generation，POST 增加 generation 并通知所有节点（需要 WithGenerationAdmin 开启），
+// 带 generation 参数的 POST 表示其他节点通知的新 generation
+const generationPath = "_generation"
+
+// generationExt 是保存 generation 的文件的扩展名，文件位于磁盘缓存的目录中：<dir>/<groupName>.generation
+const generationExt = ".generation"
+
+// maxGenerationJump 是一次从其他节点得知的 generation 最多能比当前的大多少，
+// 正常情况下只有节点长时间离线才会落后，超过该值的通常是伪造或者错误的请求
+const maxGenerationJump = 1 << 16
+
+// ErrGenerationExhausted 表示 generation 已经达到最大值，不能再增加
+var ErrGenerationExhausted = errors.New("groupcache: generation exhausted")
+
+// GenerationPublisher 是 PeerPicker 可以选择实现的接口，
+// 实现了该接口时，BumpGeneration 会立即将新的 generation 通知给所有节点
+type GenerationPublisher interface {
+	PublishGeneration(group string, gen uint64) error
+}
+
+// Generation 返回 Group 当前的 generation
+func (g *Group) Generation() uint64 {
+	return atomic.LoadUint64(&g.generation)
+}
+
+// BumpGeneration 增加 generation，使得当前节点所有的旧缓存立即失效，返回新的 generation。
+// 如果 peers 实现了 GenerationPublisher，会同时通知其他节点，返回的错误是通知失败的错误，
+// 通知失败的节点会在下一次与其他节点通信时得知新的 generation
+func (g *Group) BumpGeneration() (uint64, error) {
+	var gen uint64
+	for {
+		cur := atomic.LoadUint64(&g.generation)
+		if cur == math.MaxUint64 {
+			// 回绕到 0 会重新读到最早的缓存
+			return cur, ErrGenerationExhausted
+		}
+		gen = cur + 1
+		if atomic.CompareAndSwapUint64(&g.generation, cur, gen) {
+			break
+		}
+	}
+	g.persistGeneration()
+	g.logger.Info("generation bumped", "node", g.addr(), "group", g.name, "generation", gen)
+	if p, ok := g.peers.(GenerationPublisher); ok {
+		return gen, p.PublishGeneration(g.name, gen)
+	}
+	return gen, nil
+}
+
+// observeGeneration 在得知其他节点的 generation 时调用，只会增大不会减小，
+// 比当前的 generation 大 maxGenerationJump 以上时忽略
+func (g *Group) observeGeneration(gen uint64) {
+	if cur := g.Generation(); gen > cur && gen-cur > maxGenerationJump {
+		g.logger.Warn("generation jump too large, ignored", "node", g.addr(), "group", g.name,
+			"generation", cur, "observed", gen)
+		return
+	}
+	if g.raiseGeneration(gen) {
+		g.logger.Info("generation observed", "node", g.addr(), "group", g.name, "generation", gen)
+	}
+}
+
+// raiseGeneration 将 generation 增大到 gen 并保存，gen 不大于当前的 generation 时返回 false。
+// 快照等本地保存的 generation 直接使用该方法恢复，不受 maxGenerationJump 的限制
+func (g *Group) raiseGeneration(gen uint64) bool {
+	for {
+		cur := atomic.LoadUint64(&g.generation)
+		if gen <= cur {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&g.generation, cur, gen) {
+			g.persistGeneration()
+			return true
+		}
+	}
+}
+
+// persistGeneration 将当前的 generation 写入磁盘缓存目录下的文件，没有启用磁盘缓存时什么也不做。
+// 在 genMu 中读取最新的值再写入，并发修改时最后写入的总是最大的 generation
+func (g *Group) persistGeneration() {
+	if g.diskTier == nil {
+		return
+	}
+	g.genMu.Lock()
+	defer g.genMu.Unlock()
+	err := writeFileAtomic(g.generationPath(), func(w io.Writer) error {
+		_, err := w.Write(strconv.AppendUint(nil, g.Generation(), 10))
+		return err
+	})
+	if err != nil {
+		g.logger.Error("persist generation failed", "group", g.name, "err", err)
+	}
+}
+
+// loadGeneration 从磁盘缓存目录下的文件恢复 generation，没有启用磁盘缓存或者没有保存过时什么也不做
+func (g *Group) loadGeneration() {
+	if g.diskTier == nil {
+		return
+	}
+	b, err := os.ReadFile(g.generationPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var gen uint64
+	if err == nil {
+		gen, err = strconv.ParseUint(string(b), 10, 64)
+	}
+	if err != nil {
+		g.logger.Error("load generation failed", "group", g.name, "err", err)
+		return
+	}
+	atomic.StoreUint64(&g.generation, gen)
+}
+
+// generationPath 返回保存 generation 的文件路径
+func (g *Group) generationPath() string {
+	return filepath.Join(g.diskTier.Dir(), url.PathEscape(g.name)+generationExt)
+}
+
+// cacheKey 返回 key 在本地缓存中的 key，格式为 <generation>/<key>
+func cacheKey(gen uint64, key string) string {
+	return strconv.FormatUint(gen, 10) + "/" + key
+}
+
+// userKey 是 cacheKey 的逆操作
+func userKey(ck string) string {
+	return ck[strings.IndexByte(ck, '/')+1:]
+}
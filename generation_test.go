@@ -0,0 +1,221 @@
+package groupcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"void.io/x/cache/diskcache"
+)
+
+// startNode 启动一个使用独立 Registry 的节点，返回该节点的 Group、HTTPPool 和地址
+func startNode(t testing.TB, name string, getter Getter, opts ...GroupOption) (*Group, *HTTPPool, string) {
+	var pool *HTTPPool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	host, port, _ := net.SplitHostPort(addr)
+
+	registry := NewRegistry()
+	group := registry.NewGroup(name, 1024, getter, opts...)
+	pool = NewHTTPPool(host, port, WithRegistry(registry))
+	group.RegisterPeers(pool)
+	return group, pool, addr
+}
+
+func TestGeneration(t *testing.T) {
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	})
+	a, poolA, addrA := startNode(t, "generation", getter)
+	b, poolB, addrB := startNode(t, "generation", getter)
+	poolA.Set(addrA, addrB)
+	poolB.Set(addrA, addrB)
+
+	// 管理接口默认关闭
+	res, err := http.Post("http://"+addrA+defaultUrl+generationPath+"/generation", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden || a.Generation() != 0 {
+		t.Fatalf("bump should be rejected by default, got %v, generation %d", res.Status, a.Generation())
+	}
+	WithGenerationAdmin(true)(poolA)
+
+	// 找一个由 a 负责的 key，b 会向 a 请求
+	key := "k"
+	for i := 0; poolA.peers.Get(key) != addrA; i++ {
+		key = "k" + string(rune('a'+i))
+	}
+	a.Get(key)
+	a.Get(key)
+	if loads != 1 {
+		t.Fatalf("want 1 load, got %d", loads)
+	}
+
+	// 通过管理接口增加 generation，b 立即得知新的 generation，a 的旧缓存失效
+	res, err = http.Post("http://"+addrA+defaultUrl+generationPath+"/generation", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if a.Generation() != 1 || b.Generation() != 1 {
+		t.Fatalf("want generation 1 on every node, got %d, %d", a.Generation(), b.Generation())
+	}
+	a.Get(key)
+	if loads != 2 {
+		t.Fatalf("old generation should be invalidated, loads: %d", loads)
+	}
+
+	// 没有通知到的节点会在请求中得知新的 generation
+	b.observeGeneration(5)
+	if _, err := b.Get(key); err != nil {
+		t.Fatal(err)
+	}
+	if a.Generation() != 5 || loads != 3 {
+		t.Fatalf("generation should spread through peer requests, got %d, loads %d", a.Generation(), loads)
+	}
+	if _, err := a.BumpGeneration(); err != nil || b.Generation() != 6 {
+		t.Fatalf("BumpGeneration should publish to peers, got %d, %v", b.Generation(), err)
+	}
+}
+
+func TestGenerationUntrusted(t *testing.T) {
+	g, pool, addr := startNode(t, "generation-untrusted", GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	pool.Set(addr)
+	serve := func(method, target, remote string) *http.Response {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+	const stranger = "192.0.2.1:1234"
+	notify := defaultUrl + generationPath + "/generation-untrusted?generation="
+
+	// 不在哈希环中的客户端不能修改 generation
+	res := serve(http.MethodPost, notify+"3", stranger)
+	body, _ := io.ReadAll(res.Body)
+	if e := readError(addr, res, body); res.StatusCode != http.StatusForbidden || e.Code != codeForbidden {
+		t.Fatalf("want forbidden, got %v %v", res.Status, e.Code)
+	}
+	if serve(http.MethodGet, defaultUrl+"generation-untrusted/k?generation=3", stranger); g.Generation() != 0 {
+		t.Fatalf("generation from unknown client should be ignored, got %d", g.Generation())
+	}
+
+	// 节点通知的 generation 不能一次增大太多
+	serve(http.MethodPost, notify+strconv.FormatUint(math.MaxUint64, 10), "127.0.0.1:1")
+	if g.Generation() != 0 {
+		t.Fatalf("too large generation should be ignored, got %d", g.Generation())
+	}
+	if res := serve(http.MethodPost, notify+"3", "127.0.0.1:1"); res.StatusCode != http.StatusOK || g.Generation() != 3 {
+		t.Fatalf("generation from peer should be accepted, got %v, generation %d", res.Status, g.Generation())
+	}
+
+	// 达到最大值后不会回绕到 0
+	atomic.StoreUint64(&g.generation, math.MaxUint64)
+	if gen, err := g.BumpGeneration(); !errors.Is(err, ErrGenerationExhausted) || gen != math.MaxUint64 {
+		t.Fatalf("want ErrGenerationExhausted, got %d, %v", gen, err)
+	}
+}
+
+func TestGenerationPersisted(t *testing.T) {
+	dir := t.TempDir()
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	})
+	// newNode 模拟一次进程启动，返回的 cleanup 模拟退出
+	newNode := func() (*Group, func()) {
+		store, err := diskcache.Open(filepath.Join(dir, "disk"), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRegistry()
+		g := r.NewGroup("generation-persisted", 1<<10, getter, WithSnapshotDir(dir), WithDiskTier(store))
+		return g, func() {
+			if err := r.Shutdown(); err != nil {
+				t.Fatal(err)
+			}
+			store.Close()
+		}
+	}
+
+	g, stop := newNode()
+	g.Get("a")
+	g.spillToDisk(cacheKey(0, "a"), &ByteView{b: []byte("a")})
+	g.BumpGeneration()
+	g.Get("a")
+	stop()
+
+	// 重启后 generation 不会回到 0，旧 generation 的缓存（包括磁盘中的）不会再被读到
+	g, stop = newNode()
+	defer stop()
+	if g.Generation() != 1 {
+		t.Fatalf("generation should survive restarts, got %d", g.Generation())
+	}
+	if got := fmt.Sprint(cacheKeys(g.mainCache)); got != "[1/a]" {
+		t.Fatalf("only entries of the current generation should be restored, got %v", got)
+	}
+	if _, err := g.Get("a"); err != nil || loads != 2 {
+		t.Fatalf("want the restored value, got %v, loads %d", err, loads)
+	}
+}
+
+func TestGenerationSurvivesDiskEviction(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	open := func() (*Registry, *diskcache.Store, *Group) {
+		store, err := diskcache.Open(dir, 4<<10, diskcache.WithSegmentSize(1<<10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRegistry()
+		return r, store, r.NewGroup("generation-eviction", 1<<10, getter, WithDiskTier(store))
+	}
+
+	r, store, g := open()
+	if _, err := g.BumpGeneration(); err != nil {
+		t.Fatal(err)
+	}
+	// 旧 generation 的缓存被淘汰时不会写入磁盘
+	g.cacheEvicted(cacheKey(0, "old"), &ByteView{b: []byte("old")}, EvictCapacity)
+	if _, _, ok := store.Get(cacheKey(0, "old")); ok {
+		t.Fatal("entries of old generations should not be spilled")
+	}
+	// 写满磁盘缓存，最早的段文件会被丢弃
+	for i := 0; i < 100; i++ {
+		g.spillToDisk(cacheKey(1, fmt.Sprint(i)), &ByteView{b: make([]byte, 200)})
+	}
+	if _, _, ok := store.Get(cacheKey(1, "0")); ok {
+		t.Fatal("oldest entries should be evicted from disk")
+	}
+	r.Shutdown()
+	store.Close()
+
+	r, store, g = open()
+	defer store.Close()
+	defer r.Shutdown()
+	if g.Generation() != 1 {
+		t.Fatalf("generation should survive disk eviction, got %d", g.Generation())
+	}
+}
@@ -0,0 +1,69 @@
+package gossip
+
+// State 节点状态
+type State uint8
+
+const (
+	// StateAlive 节点存活
+	StateAlive State = iota
+	// StateSuspect 节点没有响应探测，被怀疑已经失效，但仍被视为集群成员，
+	// 如果在怀疑超时时间内没有反驳，则会被宣告死亡
+	StateSuspect
+	// StateDead 节点已经失效
+	StateDead
+	// StateLeft 节点主动离开了集群
+	StateLeft
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+// rank 用于比较相同 incarnation 下两个状态的优先级，优先级高的状态会覆盖优先级低的状态
+func (s State) rank() int {
+	switch s {
+	case StateAlive:
+		return 0
+	case StateSuspect:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// active 表示处于该状态的节点是否仍然是集群成员
+func (s State) active() bool {
+	return s == StateAlive || s == StateSuspect
+}
+
+// Member 是集群中的一个节点
+type Member struct {
+	Name string // 节点名称，集群内唯一
+	Addr string // gossip 监听地址
+	// Meta 是节点携带的元数据，一般为该节点 HTTPPool 的地址，
+	// Watch 会把它做为节点地址交给哈希环
+	Meta string
+	// Incarnation 由节点自己递增，用于反驳其他节点对它的怀疑，
+	// 也用于判断两条关于同一节点的消息哪一条更新
+	Incarnation uint64
+	State       State
+}
+
+// overrides 判断关于同一节点的消息 u 是否比当前状态 cur 更新
+func overrides(u, cur *Member) bool {
+	if u.Incarnation != cur.Incarnation {
+		return u.Incarnation > cur.Incarnation
+	}
+	return u.State.rank() > cur.State.rank()
+}
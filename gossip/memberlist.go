@@ -0,0 +1,705 @@
+// Package gossip 实现了一个嵌入式的、类 SWIM 协议的集群成员管理：
+//
+//   - 节点通过任意一个种子节点加入集群
+//   - 每个探测周期随机（轮询）挑选一个节点直接探测（ping），超时未响应时，
+//     再请求其他几个节点代为探测（ping-req），仍然没有响应则将其标记为可疑（suspect），
+//     可疑节点在超时时间内没有反驳，则被宣告死亡（dead）
+//   - 节点的加入、离开、可疑、死亡等变化捎带在探测消息中，以流言的方式传遍整个集群
+//
+// Memberlist 实现了 groupcache.Discovery，可以直接交给 HTTPPool.Watch，
+// 集群成员变化时哈希环会自动更新
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"void.io/x/cache"
+)
+
+// ErrShutdown 表示 Memberlist 已经关闭
+var ErrShutdown = errors.New("gossip: memberlist is shut down")
+
+const (
+	// DefaultProbeInterval 默认的探测周期
+	DefaultProbeInterval = time.Second
+	// DefaultIndirectChecks 默认的间接探测节点数
+	DefaultIndirectChecks = 3
+	// DefaultRetransmitMult 默认的重传倍数，每条成员变化会被捎带
+	// RetransmitMult * ceil(log10(n+1)) 次，n 为集群节点数
+	DefaultRetransmitMult = 4
+
+	maxPiggyback  = 16    // 每条消息最多捎带的成员变化数
+	maxPacketSize = 65507 // UDP 数据包的最大长度
+)
+
+type Option func(m *Memberlist)
+
+// WithName 指定节点名称，默认使用 gossip 监听地址
+func WithName(name string) Option {
+	return func(m *Memberlist) {
+		m.self.Name = name
+	}
+}
+
+// WithMeta 指定节点的元数据，一般为该节点 HTTPPool 的地址
+func WithMeta(meta string) Option {
+	return func(m *Memberlist) {
+		m.self.Meta = meta
+	}
+}
+
+// WithProbeInterval 指定探测周期
+func WithProbeInterval(interval time.Duration) Option {
+	return func(m *Memberlist) {
+		m.probeInterval = interval
+	}
+}
+
+// WithProbeTimeout 指定直接探测的超时时间，超时后会发起间接探测，
+// 必须小于探测周期，默认为探测周期的一半
+func WithProbeTimeout(timeout time.Duration) Option {
+	return func(m *Memberlist) {
+		m.probeTimeout = timeout
+	}
+}
+
+// WithIndirectChecks 指定间接探测时请求多少个节点代为探测
+func WithIndirectChecks(n int) Option {
+	return func(m *Memberlist) {
+		m.indirectChecks = n
+	}
+}
+
+// WithSuspicionTimeout 指定节点被怀疑后多久被宣告死亡，默认为 5 个探测周期
+func WithSuspicionTimeout(timeout time.Duration) Option {
+	return func(m *Memberlist) {
+		m.suspicionTimeout = timeout
+	}
+}
+
+// WithLogger 指定 Memberlist 的日志，默认为 groupcache.DefaultLogger（只输出错误）。
+// 节点被怀疑为 Info，被宣告死亡为 Warn，无法解码的数据包为 Debug
+func WithLogger(l groupcache.Logger) Option {
+	return func(m *Memberlist) {
+		m.logger = l
+	}
+}
+
+// memberState 是本地维护的某个节点的状态
+type memberState struct {
+	Member
+	changedAt time.Time // 最近一次状态变化的时间
+}
+
+type broadcast struct {
+	member    Member
+	transmits int // 已经捎带的次数
+}
+
+// Memberlist 维护集群成员列表，它本身也是集群中的一个节点
+type Memberlist struct {
+	conn *net.UDPConn
+
+	// 配置参数
+	probeInterval    time.Duration
+	probeTimeout     time.Duration
+	indirectChecks   int
+	suspicionTimeout time.Duration
+	retransmitMult   int
+	logger           groupcache.Logger
+
+	mu         sync.Mutex
+	self       Member
+	members    map[string]*memberState // 不包括自己
+	probeOrder []string                // 本轮的探测顺序
+	probeIdx   int
+	queue      []*broadcast // 待传播的成员变化
+	watchers   map[chan struct{}]struct{}
+	leaving    bool
+
+	seq         uint32 // 消息序号，原子操作
+	ackMu       sync.Mutex
+	ackHandlers map[uint32]func()
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// New 在 bindAddr（e.g. "127.0.0.1:7946"）上监听 UDP 并启动探测，端口为 0 时随机分配，
+// 返回的 Memberlist 只包含自己，需要调用 Join 加入已有集群
+func New(bindAddr string, opts ...Option) (*Memberlist, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Memberlist{
+		conn:           conn,
+		retransmitMult: DefaultRetransmitMult,
+		members:        make(map[string]*memberState),
+		watchers:       make(map[chan struct{}]struct{}),
+		ackHandlers:    make(map[uint32]func()),
+		closed:         make(chan struct{}),
+	}
+	m.self.Addr = conn.LocalAddr().String()
+	// 使用当前时间初始化 incarnation，保证节点重启后（使用相同的名字）
+	// 能够覆盖掉集群里关于它的旧状态（比如 dead）
+	m.self.Incarnation = uint64(time.Now().UnixNano())
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.self.Name == "" {
+		m.self.Name = m.self.Addr
+	}
+	if m.probeInterval <= 0 {
+		m.probeInterval = DefaultProbeInterval
+	}
+	if m.probeTimeout <= 0 || m.probeTimeout >= m.probeInterval {
+		m.probeTimeout = m.probeInterval / 2
+	}
+	if m.indirectChecks <= 0 {
+		m.indirectChecks = DefaultIndirectChecks
+	}
+	if m.suspicionTimeout <= 0 {
+		m.suspicionTimeout = 5 * m.probeInterval
+	}
+	if m.logger == nil {
+		m.logger = groupcache.DefaultLogger
+	}
+
+	m.wg.Add(2)
+	go m.readLoop()
+	go m.probeLoop()
+	return m, nil
+}
+
+// Name 返回当前节点的名称
+func (m *Memberlist) Name() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.self.Name
+}
+
+// Addr 返回当前节点的 gossip 监听地址
+func (m *Memberlist) Addr() string {
+	return m.self.Addr
+}
+
+// Join 通过种子节点加入集群，只要有一个种子节点响应就算加入成功，返回成功响应的种子节点数
+func (m *Memberlist) Join(seeds ...string) (int, error) {
+	var (
+		joined  int
+		lastErr error
+	)
+	for _, seed := range seeds {
+		addr, err := net.ResolveUDPAddr("udp", seed)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		seq := m.nextSeq()
+		synced := make(chan struct{}, 1)
+		m.setAckHandler(seq, func() { notify(synced) })
+
+		m.mu.Lock()
+		self := m.self
+		m.mu.Unlock()
+		if err := m.send(addr, &message{Type: msgJoin, Seq: seq, Members: []Member{self}}); err != nil {
+			m.deleteAckHandler(seq)
+			lastErr = err
+			continue
+		}
+		select {
+		case <-synced:
+			joined++
+		case <-time.After(m.probeInterval + m.probeTimeout):
+			lastErr = fmt.Errorf("gossip: join %v timed out", seed)
+		case <-m.closed:
+			return joined, ErrShutdown
+		}
+		m.deleteAckHandler(seq)
+	}
+	if joined == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("gossip: no seed to join")
+		}
+		return 0, lastErr
+	}
+	return joined, nil
+}
+
+// Members 返回当前集群中的所有成员（包括自己），不包括已经死亡或离开的节点
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := []Member{m.self}
+	for _, ms := range m.members {
+		if ms.State.active() {
+			members = append(members, ms.Member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members
+}
+
+// Peers 返回所有成员的 Meta（为空时使用 gossip 地址），已排序
+func (m *Memberlist) Peers() []string {
+	members := m.Members()
+	peers := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.Meta != "" {
+			peers = append(peers, member.Meta)
+		} else {
+			peers = append(peers, member.Addr)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Watch 实现了 groupcache.Discovery，每当集群成员变化时，以所有成员的 Meta 调用 update
+func (m *Memberlist) Watch(ctx context.Context, update func(peers []string)) error {
+	ch := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.watchers[ch] = struct{}{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.watchers, ch)
+		m.mu.Unlock()
+	}()
+
+	var last []string
+	for {
+		if peers := m.Peers(); last == nil || !equal(last, peers) {
+			last = peers
+			update(peers)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.closed:
+			return ErrShutdown
+		case <-ch:
+		}
+	}
+}
+
+// Leave 通知其他节点自己将要离开集群，然后关闭 Memberlist
+func (m *Memberlist) Leave() error {
+	m.mu.Lock()
+	if m.leaving {
+		m.mu.Unlock()
+		return m.Shutdown()
+	}
+	m.leaving = true
+	m.self.Incarnation++
+	m.self.State = StateLeft
+	self := m.self
+	var targets []string
+	for _, ms := range m.members {
+		if ms.State.active() {
+			targets = append(targets, ms.Addr)
+		}
+	}
+	m.mu.Unlock()
+
+	// 直接通知所有节点，而不是等待流言慢慢传播
+	for _, target := range targets {
+		if addr, err := net.ResolveUDPAddr("udp", target); err == nil {
+			m.send(addr, &message{Type: msgGossip, Members: []Member{self}})
+		}
+	}
+	return m.Shutdown()
+}
+
+// Shutdown 直接停止当前节点，不通知其他节点，其他节点会通过探测发现该节点已经失效
+func (m *Memberlist) Shutdown() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		err = m.conn.Close()
+		m.wg.Wait()
+	})
+	return err
+}
+
+func (m *Memberlist) nextSeq() uint32 {
+	return atomic.AddUint32(&m.seq, 1)
+}
+
+func (m *Memberlist) setAckHandler(seq uint32, fn func()) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+	m.ackHandlers[seq] = fn
+}
+
+func (m *Memberlist) deleteAckHandler(seq uint32) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+	delete(m.ackHandlers, seq)
+}
+
+func (m *Memberlist) invokeAckHandler(seq uint32) {
+	m.ackMu.Lock()
+	fn, ok := m.ackHandlers[seq]
+	m.ackMu.Unlock()
+	if ok {
+		fn()
+	}
+}
+
+// send 发送消息，并捎带上待传播的成员变化
+func (m *Memberlist) send(addr *net.UDPAddr, msg *message) error {
+	m.mu.Lock()
+	self := m.self
+	msg.From = &self
+	msg.Updates = m.piggybackLocked()
+	m.mu.Unlock()
+
+	b, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxPacketSize {
+		return fmt.Errorf("gossip: message too large: %d bytes", len(b))
+	}
+	_, err = m.conn.WriteToUDP(b, addr)
+	return err
+}
+
+func (m *Memberlist) sendTo(addr string, msg *message) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		m.logger.Warn("gossip resolve failed", "node", m.self.Name, "peer", addr, "err", err)
+		return
+	}
+	m.send(udpAddr, msg)
+}
+
+func (m *Memberlist) readLoop() {
+	defer m.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-m.closed:
+				return
+			default:
+			}
+			m.logger.Error("gossip read failed", "node", m.self.Name, "err", err)
+			continue
+		}
+		msg, err := decode(buf[:n])
+		if err != nil {
+			// 任何人都可以发送 UDP 数据包，不能让它们刷屏
+			m.logger.Debug("gossip decode failed", "node", m.self.Name, "from", from, "err", err)
+			continue
+		}
+		m.handle(msg, from)
+	}
+}
+
+func (m *Memberlist) handle(msg *message, from *net.UDPAddr) {
+	if msg.From != nil {
+		msg.Updates = append(msg.Updates, *msg.From)
+	}
+	m.applyAll(msg.Updates)
+
+	switch msg.Type {
+	case msgPing:
+		// 节点以相同的地址重启后，可能会收到发给旧节点的探测，此时不能响应
+		if msg.TargetName != "" && msg.TargetName != m.Name() {
+			return
+		}
+		m.send(from, &message{Type: msgAck, Seq: msg.Seq})
+	case msgAck:
+		m.invokeAckHandler(msg.Seq)
+	case msgPingReq:
+		// 代替请求者探测目标节点，收到目标节点的响应后转发给请求者
+		seq := m.nextSeq()
+		m.setAckHandler(seq, func() {
+			m.send(from, &message{Type: msgAck, Seq: msg.Seq})
+		})
+		time.AfterFunc(m.probeInterval, func() { m.deleteAckHandler(seq) })
+		m.sendTo(msg.Target, &message{Type: msgPing, Seq: seq, TargetName: msg.TargetName})
+	case msgJoin:
+		m.applyAll(msg.Members)
+		m.send(from, &message{Type: msgSync, Seq: msg.Seq, Members: m.state()})
+	case msgSync:
+		m.applyAll(msg.Members)
+		m.invokeAckHandler(msg.Seq)
+	case msgGossip:
+		m.applyAll(msg.Members)
+	}
+}
+
+// state 返回本地维护的完整成员状态（包括自己），用于同步给新加入的节点
+func (m *Memberlist) state() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := []Member{m.self}
+	for _, ms := range m.members {
+		members = append(members, ms.Member)
+	}
+	return members
+}
+
+func (m *Memberlist) applyAll(updates []Member) {
+	if len(updates) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for i := range updates {
+		if m.applyLocked(&updates[i]) {
+			changed = true
+		}
+	}
+	if changed {
+		m.notifyLocked()
+	}
+}
+
+// applyLocked 应用一条成员变化，如果本地状态因此改变，会继续传播这条变化，
+// 返回值表示成员状态是否改变，调用者需持有 m.mu
+func (m *Memberlist) applyLocked(u *Member) bool {
+	if u.Name == m.self.Name {
+		// 其他节点认为自己可疑或者死亡，递增 incarnation 并广播存活消息来反驳
+		if !m.leaving && u.State != StateAlive && u.Incarnation >= m.self.Incarnation {
+			m.self.Incarnation = u.Incarnation + 1
+			m.queueLocked(m.self)
+		}
+		return false
+	}
+
+	cur, ok := m.members[u.Name]
+	if ok && !overrides(u, &cur.Member) {
+		return false
+	}
+	if !ok {
+		cur = &memberState{}
+		m.members[u.Name] = cur
+	}
+	cur.Member = *u
+	cur.changedAt = time.Now()
+	m.queueLocked(*u)
+	return true
+}
+
+// queueLocked 将成员变化加入待传播队列，关于同一节点的旧消息会被替换
+func (m *Memberlist) queueLocked(member Member) {
+	for i, b := range m.queue {
+		if b.member.Name == member.Name {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	m.queue = append(m.queue, &broadcast{member: member})
+}
+
+// piggybackLocked 挑选捎带次数最少的若干条成员变化，超过重传次数的消息会被丢弃
+func (m *Memberlist) piggybackLocked() []Member {
+	if len(m.queue) == 0 {
+		return nil
+	}
+	limit := m.retransmitMult * int(math.Ceil(math.Log10(float64(len(m.members)+2))))
+	sort.SliceStable(m.queue, func(i, j int) bool {
+		return m.queue[i].transmits < m.queue[j].transmits
+	})
+	n := len(m.queue)
+	if n > maxPiggyback {
+		n = maxPiggyback
+	}
+	updates := make([]Member, 0, n)
+	for _, b := range m.queue[:n] {
+		updates = append(updates, b.member)
+		b.transmits++
+	}
+	kept := m.queue[:0]
+	for _, b := range m.queue {
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	m.queue = kept
+	return updates
+}
+
+func (m *Memberlist) notifyLocked() {
+	for ch := range m.watchers {
+		notify(ch)
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Memberlist) probeLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.closed:
+			return
+		case <-ticker.C:
+		}
+		m.probe()
+		m.reap()
+	}
+}
+
+// nextProbeTarget 轮询挑选下一个探测目标，每一轮开始前打乱顺序，
+// 这样既保证了每个节点在有限时间内一定会被探测到，又避免了所有节点同时探测同一个节点
+func (m *Memberlist) nextProbeTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for attempts := 0; attempts < 2; attempts++ {
+		for m.probeIdx < len(m.probeOrder) {
+			name := m.probeOrder[m.probeIdx]
+			m.probeIdx++
+			if ms, ok := m.members[name]; ok && ms.State.active() {
+				return ms.Member, true
+			}
+		}
+		m.probeOrder = m.probeOrder[:0]
+		for name, ms := range m.members {
+			if ms.State.active() {
+				m.probeOrder = append(m.probeOrder, name)
+			}
+		}
+		rand.Shuffle(len(m.probeOrder), func(i, j int) {
+			m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+		})
+		m.probeIdx = 0
+	}
+	return Member{}, false
+}
+
+// randomMembers 随机挑选最多 n 个存活的节点，不包括 exclude
+func (m *Memberlist) randomMembers(n int, exclude string) []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var candidates []Member
+	for name, ms := range m.members {
+		if name != exclude && ms.State == StateAlive {
+			candidates = append(candidates, ms.Member)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+func (m *Memberlist) probe() {
+	target, ok := m.nextProbeTarget()
+	if !ok {
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", target.Addr)
+	if err != nil {
+		m.logger.Warn("gossip resolve failed", "node", m.self.Name, "peer", target.Addr, "err", err)
+		return
+	}
+
+	seq := m.nextSeq()
+	acked := make(chan struct{}, 1)
+	m.setAckHandler(seq, func() { notify(acked) })
+	defer m.deleteAckHandler(seq)
+
+	// 直接探测
+	m.send(addr, &message{Type: msgPing, Seq: seq, TargetName: target.Name})
+	select {
+	case <-acked:
+		return
+	case <-m.closed:
+		return
+	case <-time.After(m.probeTimeout):
+	}
+
+	// 间接探测：请求其他节点代为探测，它们收到目标节点的响应后会以相同的 seq 转发给我们
+	for _, peer := range m.randomMembers(m.indirectChecks, target.Name) {
+		m.sendTo(peer.Addr, &message{
+			Type: msgPingReq, Seq: seq, Target: target.Addr, TargetName: target.Name,
+		})
+	}
+	select {
+	case <-acked:
+		return
+	case <-m.closed:
+		return
+	case <-time.After(m.probeInterval - m.probeTimeout):
+	}
+
+	// 仍然没有响应，将其标记为可疑
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.members[target.Name]; ok && cur.State == StateAlive &&
+		cur.Incarnation == target.Incarnation {
+		m.logger.Info("gossip member suspected", "node", m.self.Name, "peer", target.Name)
+		suspect := cur.Member
+		suspect.State = StateSuspect
+		if m.applyLocked(&suspect) {
+			m.notifyLocked()
+		}
+	}
+}
+
+// reap 将怀疑超时的节点宣告死亡
+func (m *Memberlist) reap() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for _, ms := range m.members {
+		if ms.State == StateSuspect && time.Since(ms.changedAt) >= m.suspicionTimeout {
+			m.logger.Warn("gossip member dead", "node", m.self.Name, "peer", ms.Name)
+			dead := ms.Member
+			dead.State = StateDead
+			if m.applyLocked(&dead) {
+				changed = true
+			}
+		}
+	}
+	if changed {
+		m.notifyLocked()
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
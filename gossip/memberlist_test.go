@@ -0,0 +1,153 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"void.io/x/cache"
+)
+
+var _ groupcache.Discovery = (*Memberlist)(nil)
+
+func newTestNode(t *testing.T, i int) *Memberlist {
+	m, err := New("127.0.0.1:0",
+		WithName(fmt.Sprintf("node-%d", i)),
+		WithMeta(fmt.Sprintf("127.0.0.1:%d", 10001+i)),
+		WithProbeInterval(50*time.Millisecond),
+		WithProbeTimeout(20*time.Millisecond),
+		WithSuspicionTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Shutdown() })
+	return m
+}
+
+// waitFor 等待所有节点看到的成员数都等于 n
+func waitFor(t *testing.T, nodes []*Memberlist, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		converged := true
+		for _, node := range nodes {
+			if len(node.Members()) != n {
+				converged = false
+				break
+			}
+		}
+		if converged {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for _, node := range nodes {
+		t.Logf("%v sees %v", node.Name(), node.Peers())
+	}
+	t.Fatalf("cluster did not converge to %d members", n)
+}
+
+func TestMemberlistConvergence(t *testing.T) {
+	var nodes []*Memberlist
+	for i := 0; i < 5; i++ {
+		nodes = append(nodes, newTestNode(t, i))
+	}
+	// 每个节点都只通过第一个节点加入集群
+	for _, node := range nodes[1:] {
+		if _, err := node.Join(nodes[0].Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, nodes, 5)
+
+	// 主动离开的节点会很快被其他节点移除
+	if err := nodes[4].Leave(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, nodes[:4], 4)
+
+	// 直接停止的节点会通过探测被发现失效
+	nodes[3].Shutdown()
+	waitFor(t, nodes[:3], 3)
+	for _, member := range nodes[0].Members() {
+		if member.Name == "node-3" || member.Name == "node-4" {
+			t.Fatalf("%v should have been removed", member.Name)
+		}
+	}
+}
+
+func TestMemberlistWatch(t *testing.T) {
+	a, b := newTestNode(t, 0), newTestNode(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []string, 16)
+	go a.Watch(ctx, func(peers []string) { updates <- peers })
+
+	if peers := <-updates; len(peers) != 1 || peers[0] != "127.0.0.1:10001" {
+		t.Fatalf("unexpected initial peers: %v", peers)
+	}
+	if _, err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case peers := <-updates:
+		if len(peers) != 2 || peers[1] != "127.0.0.1:10002" {
+			t.Fatalf("unexpected peers after join: %v", peers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for join event")
+	}
+}
+
+// levelLogger 记录每条日志的级别和内容
+type levelLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *levelLogger) add(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, level+" "+msg)
+}
+
+func (l *levelLogger) Debug(msg string, args ...any) { l.add("DEBUG", msg) }
+func (l *levelLogger) Info(msg string, args ...any)  { l.add("INFO", msg) }
+func (l *levelLogger) Warn(msg string, args ...any)  { l.add("WARN", msg) }
+func (l *levelLogger) Error(msg string, args ...any) { l.add("ERROR", msg) }
+
+func (l *levelLogger) find(entry string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, log := range l.logs {
+		if log == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMemberlistLogger(t *testing.T) {
+	logger := &levelLogger{}
+	m, err := New("127.0.0.1:0", WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	// 无法解码的数据包只记录为 Debug
+	conn, err := net.Dial("udp", m.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("garbage"))
+	for deadline := time.Now().Add(2 * time.Second); !logger.find("DEBUG gossip decode failed"); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("want a debug log for the bad packet, got %v", logger.logs)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package gossip
+
+import "encoding/json"
+
+type msgType uint8
+
+const (
+	msgPing    msgType = iota // 直接探测
+	msgAck                    // 探测的响应
+	msgPingReq                // 请求其他节点代为探测（间接探测）
+	msgJoin                   // 加入集群，请求种子节点同步完整的成员列表
+	msgSync                   // 对 msgJoin 的响应，携带完整的成员列表
+	msgGossip                 // 只用来传播成员变化，不需要响应
+)
+
+// message 是节点之间通过 UDP 传递的消息，所有消息都会捎带（piggyback）
+// 一部分最近的成员变化，成员变化就是这样以类似流言的方式传遍整个集群的
+type message struct {
+	Type msgType `json:"t"`
+	Seq  uint32  `json:"s,omitempty"`
+	// From 是发送者自己的状态，收到任何消息都能认识发送者，
+	// 不必等待关于它的流言传播过来
+	From *Member `json:"f,omitempty"`
+	// Target 和 TargetName 用于 msgPing 和 msgPingReq，表示被探测的节点
+	Target     string `json:"ta,omitempty"`
+	TargetName string `json:"tn,omitempty"`
+	// Members 是 msgSync 携带的完整成员列表
+	Members []Member `json:"m,omitempty"`
+	// Updates 是捎带的成员变化
+	Updates []Member `json:"u,omitempty"`
+}
+
+func encode(msg *message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func decode(b []byte) (*message, error) {
+	msg := &message{}
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
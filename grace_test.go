@@ -0,0 +1,74 @@
+package groupcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGracePeriod(t *testing.T) {
+	loads := map[string]int{}
+	var evicted []string
+	// 每个条目占 12 字节（"0/" + key + 9 字节的值），容量只能放下两个
+	group := NewGroup("grace", 24, GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		if key == "a" && loads[key] > 1 {
+			return nil, errors.New("database is down")
+		}
+		return []byte("value-" + key + "xx"), nil
+	}),
+		WithExpiration(20*time.Millisecond),
+		WithGracePeriod(time.Second),
+		WithOnEvict(func(key string, reason EvictReason) {
+			evicted = append(evicted, key+" "+reason.String())
+		}))
+	defer DeleteGroup("grace")
+
+	group.Get("b")
+	if _, err := group.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// 过期之后加载失败，返回旧值
+	val, err := group.Get("a")
+	if err != nil || val.String() != "value-axx" || !val.Stale() {
+		t.Fatalf("want stale value in grace period, got %v, %v", val, err)
+	}
+
+	// b 是最久未使用的，但是容量不足时优先淘汰处于 grace period 的 a
+	group.Get("c")
+	if len(evicted) != 1 || evicted[0] != "a expired" {
+		t.Fatalf("graced entry should be evicted first, got %v", evicted)
+	}
+	if _, err := group.Get("a"); err == nil {
+		t.Fatal("want error once the graced entry is gone")
+	}
+}
+
+func TestExpiredEvictedFirst(t *testing.T) {
+	var evicted []string
+	// 每个条目占 12 字节，容量只能放下三个
+	c := &cache{size: 36, onEvicted: func(key string, _ *ByteView, reason EvictReason) {
+		evicted = append(evicted, key+" "+reason.String())
+	}}
+	value := func(expire time.Time) *ByteView {
+		return &ByteView{b: []byte("0123456789"), e: expire}
+	}
+	c.Add("k1", value(time.Time{}))
+	c.Add("k2", value(time.Now().Add(-time.Second))) // 已经过期，没有被读过
+	c.Add("k3", value(time.Now().Add(time.Hour)))
+
+	// k1 是最久未使用的，但是容量不足时优先淘汰已经过期的 k2
+	c.Add("k4", value(time.Time{}))
+	if len(evicted) != 1 || evicted[0] != "k2 expired" {
+		t.Fatalf("expired entry should be evicted first, got %v", evicted)
+	}
+
+	// 全局预算回收内存时同样优先淘汰已经过期的缓存
+	c.Add("k5", value(time.Now().Add(-time.Second)))
+	evicted = nil
+	if freed := c.removeOldest(0); freed != 12 || len(evicted) != 1 || evicted[0] != "k5 expired" {
+		t.Fatalf("want the expired entry reclaimed first, got %v, freed %d", evicted, freed)
+	}
+}
@@ -1,10 +1,14 @@
 package groupcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"void.io/x/cache/diskcache"
 	"void.io/x/cache/pb/cachepb"
 	"void.io/x/cache/singleflight"
 )
@@ -21,42 +25,167 @@ func (g GetterFunc) Get(key string) ([]byte, error) {
 	return g(key)
 }
 
-var (
-	groups = make(map[string]*Group)
-	mu     sync.RWMutex
-)
+type GroupOption func(g *Group)
+
+// WithExpiration 指定从数据源获取的缓存的有效期，0 表示永不过期
+func WithExpiration(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithStaleWindow 指定缓存过期后还能继续使用多久，在这段时间内 Get 会直接返回旧值，
+// 同时在后台刷新缓存，而不是阻塞调用者等待数据源
+func WithStaleWindow(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.staleWindow = window
+	}
+}
+
+// WithGracePeriod 指定缓存过期后保留多久：在这段时间内，如果从远程节点和数据源都加载失败，
+// Get 会返回过期的旧值（Stale 为 true）而不是错误。这些缓存仍然占用容量，容量不足时会被优先淘汰
+func WithGracePeriod(period time.Duration) GroupOption {
+	return func(g *Group) {
+		g.gracePeriod = period
+	}
+}
 
 // Group 是一个缓存的命名空间，不同的 Group 可以提供不同的缓存服务，通过 name 来区分
 // 比如如果一个 Group 的 name 是 student，说明这个 Group 提供的是学生的缓存信息
 type Group struct {
-	name      string // 全局唯一
+	generation uint64 // 原子操作，放在第一个字段以保证 64 位对齐
+	versionSeq uint64 // 原子操作，最近分配的版本号
+	stats      groupStats
+
+	epochs []uint64 // 按 key 的哈希分槽的失效纪元，原子操作，参见 invalidationEpoch
+
+	name      string // 在所属的 Registry 中唯一
+	registry  *Registry
 	getter    Getter // 缓存未命中时获取源数据的回调
 	mainCache *cache
 	peers     PeerPicker
 	loader    singleflight.Group
+
+	ttl         time.Duration // 缓存有效期，0 表示永不过期
+	staleWindow time.Duration // 缓存过期后仍可返回旧值的时间窗口
+	gracePeriod time.Duration // 缓存过期后，加载失败时仍可返回旧值的时间窗口
+
+	revalidateMu sync.Mutex
+	revalidating map[string]struct{} // 正在后台刷新的 key
+
+	refreshWindow  time.Duration // 距离过期多久以内的热点 key 会被提前刷新
+	refreshMinHits int64         // 被视为热点 key 所需的最少命中次数
+	refreshWorkers int
+	refresher      *refresher // 为 nil 表示不开启提前刷新
+
+	snapshotDir string     // 快照目录，为空表示不保存快照
+	compressor  Compressor // 为 nil 表示不压缩
+
+	diskTier *diskcache.Store // mainCache 之下的磁盘缓存，为 nil 表示不启用
+	logger   Logger
+	tracer   Tracer
+
+	onHit   func(key string)
+	onMiss  func(key string)
+	onLoad  func(key string, d time.Duration, err error)
+	onEvict func(key string, reason EvictReason)
+
+	loadRate *tokenBucket  // 调用 Getter 的速率限制，为 nil 表示不限制
+	loadSem  chan struct{} // 调用 Getter 的并发限制，为 nil 表示不限制
+
+	writeMu sync.Mutex // 串行化当前节点上的写入，保证 CompareAndSet 的原子性
+	genMu   sync.Mutex // 串行化 generation 的持久化
+
+	closeMu  sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup // 正在进行的 Get 和加载，Close 时需要等待它们结束
 }
 
-func NewGroup(name string, size int64, getter Getter) *Group {
+// newGroup 创建一个还没有注册的 Group
+func newGroup(name string, size int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("getter cannot be nil")
 	}
 
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: &cache{size: size},
+		name:         name,
+		getter:       getter,
+		mainCache:    &cache{size: size},
+		epochs:       make([]uint64, epochSlots),
+		revalidating: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.diskTier != nil || g.onEvict != nil {
+		g.mainCache.onEvicted = g.cacheEvicted
+	}
+	if g.logger == nil {
+		g.logger = DefaultLogger
+	}
+	if g.tracer == nil {
+		g.tracer = noopTracer{}
 	}
-	mu.Lock()
-	defer mu.Unlock()
-	groups[name] = g
-
 	return g
 }
 
-func GetGroup(name string) *Group {
-	mu.RLock()
-	defer mu.RUnlock()
-	return groups[name]
+// init 在 Group 注册成功之后调用，完成需要启动后台任务或者读取磁盘的初始化
+func (g *Group) init() {
+	globalBudget.register(g.mainCache)
+	// 先恢复 generation，快照中其他 generation 的条目不会被恢复
+	g.loadGeneration()
+	if g.refreshWindow > 0 {
+		g.refresher = newRefresher(g, g.refreshWindow, g.refreshMinHits, g.refreshWorkers)
+	}
+	if g.snapshotDir != "" {
+		// 恢复失败不影响 Group 的使用，只是需要重新从数据源加载
+		if err := g.loadSnapshot(); err != nil {
+			g.logger.Error("load snapshot failed", "group", g.name, "err", err)
+		}
+	}
+}
+
+// Close 关闭 Group：新的 Get 会返回 ErrGroupClosed，等待正在进行的加载结束后，
+// 停止提前刷新、保存快照（如果指定了快照目录）、释放缓存占用的内存，并将其从所属的 Registry 中移除，
+// 之后就可以用同样的名字创建新的 Group。重复调用 Close 不会有任何效果
+func (g *Group) Close() error {
+	g.closeMu.Lock()
+	if g.closed {
+		g.closeMu.Unlock()
+		return nil
+	}
+	g.closed = true
+	g.closeMu.Unlock()
+
+	g.registry.remove(g)
+
+	g.inflight.Wait()
+	if g.refresher != nil {
+		g.refresher.stop()
+	}
+	err := g.SaveSnapshot()
+	g.mainCache.clear()
+	return err
+}
+
+// release 释放 init 中分配的资源，用于初始化之后没能注册的 Group，不会保存快照
+func (g *Group) release() {
+	if g.refresher != nil {
+		g.refresher.stop()
+	}
+	g.mainCache.clear()
+}
+
+// enter 在开始 Get 或加载之前调用，Group 已经关闭时返回 false，
+// 返回 true 时调用者结束后必须调用 g.inflight.Done
+func (g *Group) enter() bool {
+	g.closeMu.RLock()
+	defer g.closeMu.RUnlock()
+	if g.closed {
+		return false
+	}
+	g.inflight.Add(1)
+	return true
 }
 
 func (g *Group) RegisterPeers(peers PeerPicker) {
@@ -66,47 +195,142 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
+// addr 返回当前节点的地址，用于日志输出，单机环境（未注册 peers）下返回 "local"
+func (g *Group) addr() string {
+	if g.peers == nil {
+		return "local"
+	}
+	return g.peers.Addr()
+}
+
 func (g *Group) Get(key string) (*ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，ctx 用于传递追踪上下文
+func (g *Group) GetContext(ctx context.Context, key string) (*ByteView, error) {
+	val, err := g.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(val)
+}
+
+// get 查找 key 对应的缓存，返回的 ByteView 可能是压缩过的，
+// 节点之间传输时直接使用压缩后的数据，返回给调用者之前需要解压
+func (g *Group) get(ctx context.Context, key string) (val *ByteView, err error) {
 	if key == "" {
 		return nil, fmt.Errorf("key is required")
 	}
+	if !g.enter() {
+		return nil, ErrGroupClosed
+	}
+	defer g.inflight.Done()
+
+	ctx, span := g.tracer.Start(ctx, "groupcache.Get", "group", g.name, "key", key)
+	defer func() { span.End(err) }()
+	atomic.AddInt64(&g.stats.gets, 1)
 
-	// 从 lru 中查找
-	val, exist := g.mainCache.get(key)
+	// 从 lru 中查找，只会找到当前 generation 的缓存
+	ck := cacheKey(g.Generation(), key)
+	val, exist := g.mainCache.get(ck)
+	if !exist && g.diskTier != nil {
+		val, exist = g.getFromDisk(ck)
+	}
+	var graced *ByteView // 处于 grace period 的旧值，加载失败时返回
 	if exist {
-		log.Printf("[%v] groupcache is hit\n", g.peers.Addr())
-		return val, nil
+		now := time.Now()
+		if !val.expired(now) {
+			g.logger.Debug("cache hit", "node", g.addr(), "group", g.name, "key", key)
+			if g.refresher != nil {
+				g.refresher.touch(key, val, now)
+			}
+			span.SetAttributes("hit", true)
+			atomic.AddInt64(&g.stats.hits, 1)
+			if g.onHit != nil {
+				g.onHit(key)
+			}
+			return val, nil
+		}
+		// 已经过期，但还在 stale window 内，先返回旧值，再在后台刷新
+		if g.staleWindow > 0 && now.Before(val.e.Add(g.staleWindow)) {
+			g.logger.Debug("cache stale, revalidate in background",
+				"node", g.addr(), "group", g.name, "key", key)
+			g.revalidate(key)
+			span.SetAttributes("hit", true, "stale", true)
+			atomic.AddInt64(&g.stats.hits, 1)
+			if g.onHit != nil {
+				g.onHit(key)
+			}
+			return val.withStale(), nil
+		}
+		if g.gracePeriod > 0 && now.Before(val.e.Add(g.gracePeriod)) {
+			// 先保留旧值，加载成功时会被新值替换
+			graced = val
+			g.mainCache.grace(ck)
+		} else {
+			g.removeLocally(ck, EvictExpired)
+		}
 	}
 	// 缓存中不存在，则去指定的数据源中获取
-	return g.load(key)
+	span.SetAttributes("hit", false)
+	if g.onMiss != nil {
+		g.onMiss(key)
+	}
+	val, err = g.load(ctx, key)
+	// 数据源确认 key 已经不存在时不再返回旧值
+	if err != nil && graced != nil && !errors.Is(err, ErrNotFound) {
+		g.logger.Warn("load failed, serve expired value in grace period",
+			"node", g.addr(), "group", g.name, "key", key, "err", err)
+		span.SetAttributes("grace", true)
+		return graced.withStale(), nil
+	}
+	return val, err
+}
+
+// revalidate 在后台重新加载 key，同一个 key 同时只会有一个后台刷新，
+// 刷新同样经过 singleflight，所以也会和前台的加载合并
+func (g *Group) revalidate(key string) {
+	g.revalidateMu.Lock()
+	if _, ok := g.revalidating[key]; ok {
+		g.revalidateMu.Unlock()
+		return
+	}
+	g.revalidating[key] = struct{}{}
+	g.revalidateMu.Unlock()
+
+	go func() {
+		defer func() {
+			g.revalidateMu.Lock()
+			delete(g.revalidating, key)
+			g.revalidateMu.Unlock()
+		}()
+		if _, err := g.load(context.Background(), key); err != nil && !errors.Is(err, ErrGroupClosed) {
+			g.logger.Error("revalidate failed", "node", g.addr(), "group", g.name, "key", key, "err", err)
+		}
+	}()
 }
 
 // load 当缓存不在当前节点时调用该方法
-func (g *Group) load(key string) (value *ByteView, err error) {
-	// 使用 singleflight 进行缓存请求
-	v, err := g.loader.Do(key, func() (any, error) {
-		// 如果有远程节点，则需要确定这个 key 应该交给哪个节点进行处理（负载均衡）
-		if g.peers != nil {
-			// 确定负责处理这个 key 的节点，如果该节点不是当前节点
-			if addr, peer, notSelf := g.peers.PickPeer(key); notSelf {
-				log.Printf("[%v] -> Redirected to key[%v] at %v\n",
-					g.peers.Addr(), key, addr)
-				// 那么就从远程节点获取缓存
-				if value, err := g.getFromPeer(peer, key); err == nil {
-					return value, nil
-				} else { // 从远程节点获取缓存失败了，可能是因为远程节点已经挂掉了，此时只做日志记录
-					log.Printf(
-						"[%v]get from peer[%v] error: %v, try to get from local",
-						g.peers.Addr(), addr, err)
-				}
-			}
+// 同一个 key 的并发加载会合并，只有第一个调用者的 ctx 会传递给远程节点和数据源
+func (g *Group) load(ctx context.Context, key string) (value *ByteView, err error) {
+	if !g.enter() {
+		return nil, ErrGroupClosed
+	}
+	defer g.inflight.Done()
+
+	ctx, span := g.tracer.Start(ctx, "groupcache.singleflight", "group", g.name, "key", key)
+	defer func() { span.End(err) }()
+
+	// 使用 singleflight 进行缓存请求，不同 generation 的加载不会合并
+	gen := g.Generation()
+	v, err := g.loader.Do(cacheKey(gen, key), func() (any, error) {
+		start := time.Now()
+		value, err := g.fetch(ctx, gen, key)
+		if g.onLoad != nil {
+			g.onLoad(key, time.Since(start), err)
 		}
-		// 走到这里说明是以下几种情况：
-		// - 没有远程节点（单机环境）
-		// - 负责处理该 key 的就是当前节点
-		// - 无法从远程节点获取到缓存
-		// 这几种情况都需要当前节点从数据源获取数据，并添加到缓存
-		return g.getFromLocally(key)
+		return value, err
 	})
 	if err == nil {
 		value = v.(*ByteView)
@@ -114,26 +338,131 @@ func (g *Group) load(key string) (value *ByteView, err error) {
 	return
 }
 
+// fetch 从远程节点或者数据源获取 key，只在 singleflight 中调用
+func (g *Group) fetch(ctx context.Context, gen uint64, key string) (*ByteView, error) {
+	// 如果有远程节点，则需要确定这个 key 应该交给哪个节点进行处理（负载均衡）
+	if g.peers != nil {
+		// 确定负责处理这个 key 的节点，如果该节点不是当前节点
+		if addr, peer, notSelf := g.peers.PickPeer(key); notSelf {
+			g.logger.Debug("redirect to peer", "node", g.peers.Addr(), "group", g.name, "key", key, "peer", addr)
+			// 那么就从远程节点获取缓存
+			start := time.Now()
+			atomic.AddInt64(&g.stats.peerLoads, 1)
+			value, err := g.getFromPeer(ctx, gen, addr, peer, key)
+			if err == nil {
+				g.logger.Debug("loaded from peer", "group", g.name, "key", key,
+					"peer", addr, "latency", time.Since(start))
+				return value, nil
+			}
+			// 从远程节点获取缓存失败了，可能是因为远程节点已经挂掉了，此时只做日志记录
+			if errors.Is(err, ErrNotFound) {
+				// 远程节点已经从数据源确认了 key 不存在，不需要再从本地数据源加载
+				return nil, err
+			}
+			atomic.AddInt64(&g.stats.peerErrors, 1)
+			if errors.Is(err, ErrCircuitOpen) {
+				// 熔断器打开，请求根本没有发出，直接跳过该节点
+				g.logger.Debug("peer circuit is open, load locally",
+					"node", g.peers.Addr(), "group", g.name, "key", key, "peer", addr)
+			} else {
+				g.logger.Warn("load from peer failed, load locally",
+					"node", g.peers.Addr(), "group", g.name, "key", key, "peer", addr,
+					"latency", time.Since(start), "err", err)
+			}
+		}
+	}
+	// 走到这里说明是以下几种情况：
+	// - 没有远程节点（单机环境）
+	// - 负责处理该 key 的就是当前节点
+	// - 无法从远程节点获取到缓存
+	// 这几种情况都需要当前节点从数据源获取数据，并添加到缓存
+	return g.getFromLocally(ctx, gen, key)
+}
+
 // 从远程节点获取数据
-func (g *Group) getFromPeer(peer PeerGetter, key string) (*ByteView, error) {
-	req := &cachepb.Request{Key: key, Group: g.name}
+func (g *Group) getFromPeer(ctx context.Context, gen uint64, addr string, peer PeerGetter, key string) (val *ByteView, err error) {
+	ctx, span := g.tracer.Start(ctx, "groupcache.getFromPeer", "group", g.name, "key", key, "peer", addr)
+	defer func() { span.End(err) }()
+
+	req := &cachepb.Request{
+		Key:          key,
+		Group:        g.name,
+		AcceptCodecs: registeredCodecs(),
+		TraceParent:  g.tracer.Inject(ctx),
+		Generation:   gen,
+	}
+	// 本地已有该 key 的副本时（例如在 stale window 内后台刷新），带上它的 ETag，
+	// 值没有变化时远程节点不再发送 value
+	ck := cacheKey(gen, key)
+	epoch := g.invalidationEpoch(key)
+	local, hasLocal := g.mainCache.peek(ck)
+	if hasLocal {
+		req.IfNoneMatch = valueETag(local)
+	}
 	resp := &cachepb.Response{}
 	if err := peer.Get(req, resp); err != nil {
 		return &ByteView{}, err
 	}
-	return &ByteView{b: resp.Value}, nil
+	g.observeGeneration(resp.Generation)
+	if resp.NotModified && hasLocal {
+		span.SetAttributes("not_modified", true)
+		val = &ByteView{b: local.b, codec: local.codec, version: local.version}
+		if resp.Expire != 0 {
+			val.e = time.Unix(0, resp.Expire)
+		}
+		// 更新本地副本的过期时间
+		g.addLoaded(ck, epoch, val)
+		return val, nil
+	}
+	val = &ByteView{b: resp.Value, stale: resp.Stale, codec: resp.Codec, version: resp.Version}
+	if resp.Expire != 0 {
+		val.e = time.Unix(0, resp.Expire)
+	}
+	if hasLocal && !val.stale {
+		// 值或者版本号已经变化，替换本地的旧副本
+		g.addLoaded(ck, epoch, val)
+	}
+	return val, nil
 }
 
 // getFromLocally 通过调用 g.getter 从本地获得数据，同时添加到缓存
-func (g *Group) getFromLocally(key string) (val *ByteView, err error) {
-	log.Printf("[%v] get from locally\n", g.peers.Addr())
-	v, err := g.getter.Get(key)
+// gen 为开始加载时的 generation，加载期间 generation 发生变化时，结果会添加到旧的 generation 下
+func (g *Group) getFromLocally(ctx context.Context, gen uint64, key string) (val *ByteView, err error) {
+	_, span := g.tracer.Start(ctx, "groupcache.getFromLocally", "group", g.name, "key", key)
+	defer func() { span.End(err) }()
+
+	if err := g.acquireLoad(ctx); err != nil {
+		g.logger.Warn("load throttled", "node", g.addr(), "group", g.name, "key", key)
+		return nil, err
+	}
+	defer g.releaseLoad()
+
+	atomic.AddInt64(&g.stats.loads, 1)
+	start := time.Now()
+	epoch := g.invalidationEpoch(key)
+	var (
+		v       []byte
+		version uint64
+	)
+	if vg, ok := g.getter.(VersionedGetter); ok {
+		v, version, err = vg.GetVersioned(key)
+	} else {
+		v, err = g.getter.Get(key)
+	}
+	g.logger.Debug("loaded from getter", "node", g.addr(), "group", g.name, "key", key,
+		"latency", time.Since(start), "err", err)
 	if err != nil {
+		atomic.AddInt64(&g.stats.loadErrors, 1)
 		return nil, err
 	}
-	val = &ByteView{b: v}
-	// 获取到同时添加到缓存中
-	g.addCache(key, val)
+	val = &ByteView{b: v, version: g.loadedVersion(version)}
+	if g.ttl > 0 {
+		val.e = time.Now().Add(g.ttl)
+	}
+	// 获取到同时添加到缓存中，开启压缩时缓存中保存的是压缩后的数据，
+	// 返回的也是压缩后的数据，与从缓存中取到的保持一致
+	val = g.compress(val)
+	g.addLoaded(cacheKey(gen, key), epoch, val)
 	return
 }
 
@@ -1,8 +1,12 @@
 package groupcache
 
 import (
+	"errors"
 	"log"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var data = map[string]string{
@@ -36,3 +40,103 @@ func TestGroup(t *testing.T) {
 	// 2021/09/28 14:11:50 groupcache is hit
 	// 2021/09/28 14:11:50 1
 }
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var (
+		loads   int64
+		release = make(chan struct{})
+	)
+	group := NewGroup("stale", 1024, GetterFunc(func(key string) ([]byte, error) {
+		n := atomic.AddInt64(&loads, 1)
+		if n > 1 {
+			// 后台刷新时阻塞，确保刷新期间调用者拿到的是旧值
+			<-release
+		}
+		return []byte(strconv.FormatInt(n, 10)), nil
+	}), WithExpiration(20*time.Millisecond), WithStaleWindow(time.Minute))
+
+	if val, err := group.Get("a"); err != nil || val.String() != "1" || val.Stale() {
+		t.Fatalf("first get: %v, %v", val, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// 过期后，多次 Get 都立即返回旧值，且只触发一次后台刷新
+	for i := 0; i < 5; i++ {
+		val, err := group.Get("a")
+		if err != nil || val.String() != "1" || !val.Stale() {
+			t.Fatalf("stale get %d: %v, %v", i, val, err)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		val, err := group.Get("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !val.Stale() {
+			if val.String() != "2" {
+				t.Fatalf("want refreshed value 2, got %v", val)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("value was not revalidated in background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&loads); n != 2 {
+		t.Fatalf("getter should be called twice, got %d", n)
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	group := NewGroup("close", 1024, GetterFunc(func(key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte(key), nil
+	}))
+	if _, err := CreateGroup("close", 1024, GetterFunc(nil)); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("want ErrGroupExists, got %v", err)
+	}
+
+	loaded := make(chan error)
+	go func() {
+		_, err := group.Get("a")
+		loaded <- err
+	}()
+	<-started
+
+	closed := make(chan error)
+	go func() { closed <- group.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("Close should wait for in-flight loads")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if _, err := group.Get("a"); !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("want ErrGroupClosed, got %v", err)
+	}
+
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if group.mainCache.bytes() != 0 || GetGroup("close") != nil {
+		t.Fatal("closed group should drop its cache and be unregistered")
+	}
+
+	// 关闭之后可以用同样的名字替换成新的 Getter
+	group = NewGroup("close", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("new"), nil
+	}))
+	defer DeleteGroup("close")
+	if val, err := group.Get("a"); err != nil || val.String() != "new" {
+		t.Fatalf("want new value, got %v, %v", val, err)
+	}
+}
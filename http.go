@@ -1,14 +1,22 @@
 package groupcache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"void.io/x/cache/consistenthash"
 	"void.io/x/cache/pb/cachepb"
@@ -18,9 +26,15 @@ import (
 
 const defaultUrl = "/groupcache/"
 
+// codecParam 是请求方声明自己支持的压缩算法的 query 参数
+const codecParam = "codec"
+
 // DefaultReplicas 默认虚拟节点数量
 const DefaultReplicas = 50
 
+// maxRequestBytes 是 Get 请求体的大小上限，请求体中只有 key 和少量元数据
+const maxRequestBytes = 1 << 20
+
 type HTTPPoolOption func(pool *HTTPPool)
 
 func WithBaseURL(url string) HTTPPoolOption {
@@ -43,6 +57,37 @@ func WithHashFunc(fn consistenthash.HashFunc) HTTPPoolOption {
 	}
 }
 
+// WithBreaker 指定每个远程节点的熔断器配置
+func WithBreaker(cfg BreakerConfig) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.breakerCfg = cfg
+	}
+}
+
+// WithPeerTimeout 指定请求远程节点的超时时间，0 表示不超时
+func WithPeerTimeout(timeout time.Duration) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.peerTimeout = timeout
+	}
+}
+
+// WithRegistry 指定处理远程节点请求时从哪个 Registry 中查找 Group，默认为 DefaultRegistry
+func WithRegistry(r *Registry) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.registry = r
+	}
+}
+
+// WithGenerationAdmin 开启 POST <baseURL>/_generation/<groupName> 手动增加 generation 的管理接口，
+// 该接口没有鉴权，任何能访问节点的客户端都可以清空所有缓存，所以默认关闭，开启时应当限制访问来源。
+// 请求中携带的 generation（其他节点的通知，以及节点之间请求中附带的 generation）只接受来自哈希环中节点的地址，
+// 开启时也接受任意来源的 generation
+func WithGenerationAdmin(enabled bool) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.generationAdmin = enabled
+	}
+}
+
 // HTTPPool 保存了当前分布式系统里的所有节点，同时其本身也是一个节点
 type HTTPPool struct {
 	host, port string
@@ -52,18 +97,32 @@ type HTTPPool struct {
 	peers *consistenthash.Map // 哈希环，用来保存所有节点，同时实现负载均衡
 
 	// 映射远程节点与对应的 httpGetter。每一个远程节点对应一个 httpGetter
-	httpGetters map[string]PeerGetter
+	httpGetters map[string]*httpGetter
+	// 所有节点的 IP，只接受来自这些 IP 的请求中携带的 generation
+	peerIPs map[string]bool
 
 	// 配置参数，如果不指定，则使用默认值
-	baseURL  string                  // /<baseURL>/<groupName>/<key>
-	replicas int64                   // hash 环的虚拟节点数
-	hashFunc consistenthash.HashFunc // 调用者自定义的哈希函数
+	baseURL     string                  // /<baseURL>/<groupName>/<key>
+	replicas    int64                   // hash 环的虚拟节点数
+	hashFunc    consistenthash.HashFunc // 调用者自定义的哈希函数
+	breakerCfg  BreakerConfig           // 每个远程节点的熔断器配置
+	peerTimeout time.Duration           // 请求远程节点的超时时间
+	registry    *Registry               // 查找 Group 的 Registry
+	logger      Logger
+
+	generationAdmin bool  // 是否允许通过 HTTP 手动增加 generation
+	maxSetBytes     int64 // Set 请求体的大小上限
+
+	invalidateAttempts int           // 每个节点最多尝试发送失效通知的次数
+	invalidateBackoff  time.Duration // 第一次重试失效通知前等待的时间
+	seenEvents         *eventDedup   // 最近收到的失效通知，用于去重
 }
 
 func NewHTTPPool(host, port string, opts ...HTTPPoolOption) *HTTPPool {
 	h := &HTTPPool{
 		addr:        fmt.Sprintf("%v:%v", host, port),
-		httpGetters: make(map[string]PeerGetter),
+		httpGetters: make(map[string]*httpGetter),
+		seenEvents:  newEventDedup(invalidationDedupSize),
 	}
 
 	for _, opt := range opts {
@@ -76,6 +135,21 @@ func NewHTTPPool(host, port string, opts ...HTTPPoolOption) *HTTPPool {
 	if h.replicas == 0 {
 		h.replicas = DefaultReplicas
 	}
+	if h.registry == nil {
+		h.registry = DefaultRegistry
+	}
+	if h.logger == nil {
+		h.logger = DefaultLogger
+	}
+	if h.maxSetBytes <= 0 {
+		h.maxSetBytes = DefaultMaxSetBytes
+	}
+	if h.invalidateAttempts <= 0 {
+		h.invalidateAttempts = DefaultInvalidationAttempts
+	}
+	if h.invalidateBackoff <= 0 {
+		h.invalidateBackoff = DefaultInvalidationBackoff
+	}
 	// 如果 hashFunc 为 nil，那么 New 内部会使用默认的哈希函数
 	h.peers = consistenthash.New(h.replicas, h.hashFunc)
 
@@ -83,60 +157,242 @@ func NewHTTPPool(host, port string, opts ...HTTPPoolOption) *HTTPPool {
 }
 
 func (h *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !strings.HasPrefix(r.URL.Path, h.baseURL) {
-		errmsg := fmt.Sprintf(
-			`request url need contain a baseURL: %v, 
-					e.g <scheme>://<host>/%v/<groupName>/<key>,
-					you request url is %v`, h.baseURL, h.baseURL, r.URL.Path)
-		w.Write([]byte(errmsg))
-		panic(errmsg)
-	}
-	log.Printf("[%v][%v] %v \n", h.addr, r.Method, r.URL.Path)
+	defer h.recover(w, r)
+
+	// 使用转义后的路径，key 中的 '/' 会被转义为 %2F，不会与分隔符混淆
+	p := r.URL.EscapedPath()
+	if !strings.HasPrefix(p, h.baseURL) {
+		writeErrorCode(w, codeBadRequest, http.StatusBadRequest, fmt.Sprintf(
+			"request url need contain a baseURL: %v, e.g <scheme>://<host>%v<groupName>/<key>, your request url is %v",
+			h.baseURL, h.baseURL, r.URL.Path))
+		return
+	}
+	h.logger.Debug("serve request", "node", h.addr, "method", r.Method, "path", r.URL.Path)
 	// /<baseURL>/<groupName>/<key>，将 <groupName>/<key> 这部分以 '/' 做为
 	// 分隔符，分隔出两个子串，也就是 groupName 和 key
-	n := strings.SplitN(r.URL.Path[len(h.baseURL):], "/", 2)
-	//log.Println(r.URL.Path, r.URL.Path[len(h.baseURL):])
-	if len(n) < 2 {
-		http.Error(w, "url format is wrong", http.StatusBadRequest)
+	rest := p[len(h.baseURL):]
+	switch {
+	case strings.HasPrefix(rest, generationPath+"/"):
+		groupName, err := url.PathUnescape(rest[len(generationPath)+1:])
+		if err != nil {
+			writeErrorCode(w, codeBadRequest, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.serveGeneration(w, r, groupName)
+		return
+	case strings.HasPrefix(rest, invalidatePath+"/"):
+		h.serveInvalidation(w, r, rest[len(invalidatePath)+1:])
 		return
 	}
 
-	groupName := n[0]
-	key := n[1]
-	//log.Printf("groupname: %v, key: %v \n", groupName, key)
+	var (
+		groupName, key string
+		err            error
+	)
+	if bodyKey := !strings.Contains(rest, "/"); bodyKey && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+		// <baseURL>/<groupName>，key 在 proto 编码的请求体中（POST 为 Request，PUT 为 SetRequest），
+		// 不经过 URL，任意字节都可以原样传递，httpGetter 使用这种方式
+		groupName, err = url.PathUnescape(rest)
+	} else {
+		groupName, key, err = splitPath(rest)
+	}
+	if err != nil {
+		writeErrorCode(w, codeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	group := GetGroup(groupName)
+	group := h.registry.GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		writeError(w, fmt.Errorf("%w: %v", ErrGroupNotFound, groupName))
+		return
+	}
+	if r.Method == http.MethodPut {
+		h.serveSet(w, r, group, key)
 		return
 	}
 
-	// 调用了 group.Get ，如果缓存不存在，则会从数据源获取
-	val, err := group.Get(key)
+	in := &cachepb.Request{Group: groupName, Key: key}
+	if r.Method == http.MethodPost && key == "" {
+		if err := readRequest(w, r, in); err != nil {
+			writeErrorCode(w, codeBadRequest, http.StatusBadRequest, err.Error())
+			return
+		}
+		key = in.Key
+	} else {
+		in.AcceptCodecs = r.URL.Query()[codecParam]
+		in.TraceParent = r.Header.Get(traceHeader)
+		if gen := r.URL.Query().Get(generationParam); gen != "" {
+			in.Generation, _ = strconv.ParseUint(gen, 10, 64)
+		}
+	}
+	if h.trustGeneration(r) {
+		group.observeGeneration(in.Generation)
+	}
+
+	// 调用了 group.get ，如果缓存不存在，则会从数据源获取，
+	// 拿到的可能是压缩过的数据，请求方支持该压缩算法时直接发送压缩后的数据
+	ctx := group.tracer.Extract(r.Context(), in.TraceParent)
+	val, err := group.get(ctx, key)
+	if err == nil && val.codec != "" && !contains(in.AcceptCodecs, val.codec) {
+		val, err = decompress(val)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+	// httpGetter 通过 If-None-Match 头发送已有的值的 ETag，值没有变化时只返回 304。
+	// ETag 缓存在 val 中，每个值只计算一次
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		ifNoneMatch = in.IfNoneMatch
+	}
+	if setCacheHeaders(w.Header(), ifNoneMatch, val, valueETag(val)) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	// octet-stream 表示未知的文件类型
 	w.Header().Set("Content-Type", "application/octet-stream")
 	// 使用 proto 编码响应内容
-	resp, err := proto.Marshal(&cachepb.Response{Value: val.ByteSlice()})
+	out := &cachepb.Response{
+		Value:      val.ByteSlice(),
+		Stale:      val.Stale(),
+		Codec:      val.codec,
+		Generation: group.Generation(),
+		Version:    val.version,
+	}
+	if e := val.Expire(); !e.IsZero() {
+		out.Expire = e.UnixNano()
+	}
+	resp, err := proto.Marshal(out)
+	if err != nil {
+		h.logger.Error("proto marshal failed", "node", h.addr, "group", groupName, "key", key, "err", err)
+		writeError(w, err)
+		return
+	}
+	w.Write(resp)
+}
+
+// recover 在处理请求的过程中发生 panic 时返回 500，而不是让 net/http 中断连接，
+// http.ErrAbortHandler 表示有意中断请求，继续向上传递
+func (h *HTTPPool) recover(w http.ResponseWriter, r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	h.logger.Error("panic serving request", "node", h.addr, "method", r.Method, "path", r.URL.Path,
+		"panic", v, "stack", string(debug.Stack()))
+	writeErrorCode(w, codeInternal, http.StatusInternalServerError, fmt.Sprintf("panic: %v", v))
+}
+
+// readRequest 读取 proto 编码的 Request 请求体
+func readRequest(w http.ResponseWriter, r *http.Request, in *cachepb.Request) error {
+	body, err := readBody(w, r, maxRequestBytes)
 	if err != nil {
-		log.Println("proto marshal error: ", err)
+		return err
+	}
+	if err := proto.Unmarshal(body, in); err != nil {
+		return err
+	}
+	if len(in.KeyBytes) > 0 {
+		in.Key = string(in.KeyBytes)
+	}
+	return nil
+}
+
+// readBody 读取请求体，超过 limit 时返回错误，此时 MaxBytesReader 会让服务端在响应之后关闭连接
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+}
+
+// splitPath 将转义后的 <groupName>/<key> 分隔并反转义
+func splitPath(p string) (groupName, key string, err error) {
+	n := strings.SplitN(p, "/", 2)
+	if len(n) < 2 {
+		return "", "", errors.New("url format is wrong")
+	}
+	if groupName, err = url.PathUnescape(n[0]); err != nil {
+		return "", "", err
+	}
+	if key, err = url.PathUnescape(n[1]); err != nil {
+		return "", "", err
+	}
+	return groupName, key, nil
+}
+
+// serveGeneration 处理 <baseURL>/_generation/<groupName> 请求
+func (h *HTTPPool) serveGeneration(w http.ResponseWriter, r *http.Request, groupName string) {
+	group := h.registry.GetGroup(groupName)
+	if group == nil {
+		writeError(w, fmt.Errorf("%w: %v", ErrGroupNotFound, groupName))
+		return
 	}
-	if _, err := w.Write(resp); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if gen := r.URL.Query().Get(generationParam); gen != "" {
+			// 其他节点通知的新 generation，不需要再通知其他节点
+			if !h.trustGeneration(r) {
+				writeErrorCode(w, codeForbidden, http.StatusForbidden, "generation from unknown peer")
+				return
+			}
+			n, err := strconv.ParseUint(gen, 10, 64)
+			if err != nil {
+				writeErrorCode(w, codeBadRequest, http.StatusBadRequest, "bad generation: "+gen)
+				return
+			}
+			group.observeGeneration(n)
+			break
+		}
+		if !h.generationAdmin {
+			writeErrorCode(w, codeForbidden, http.StatusForbidden, "generation admin endpoint is disabled")
+			return
+		}
+		if _, err := group.BumpGeneration(); errors.Is(err, ErrGenerationExhausted) {
+			writeError(w, err)
+			return
+		} else if err != nil {
+			// 当前节点的 generation 已经增加，通知失败的节点会在之后的通信中得知新的 generation
+			h.logger.Warn("publish generation failed", "node", h.addr, "group", groupName, "err", err)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	fmt.Fprintf(w, "%d\n", group.Generation())
+}
+
+// PublishGeneration 将 group 的新 generation 通知给其他所有节点，返回遇到的第一个错误
+func (h *HTTPPool) PublishGeneration(group string, gen uint64) error {
+	h.mu.RLock()
+	getters := make([]*httpGetter, 0, len(h.httpGetters))
+	for addr, getter := range h.httpGetters {
+		if addr != h.addr {
+			getters = append(getters, getter)
+		}
+	}
+	h.mu.RUnlock()
+
+	var first error
+	for _, getter := range getters {
+		if err := getter.publishGeneration(group, gen); err != nil && first == nil {
+			first = fmt.Errorf("publish generation to %v: %w", getter.host, err)
+		}
+	}
+	return first
 }
 
 func (h *HTTPPool) PickPeer(key string) (addr string, peer PeerGetter, notSelf bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	p := h.peers.Get(key)
 	// 找到了节点且该节点不是当前节点（如果是当前节点，那么就没必要进行 http 调用去远程获取了，
 	// 直接在本地查询即可）
 	if p != "" && p != h.addr {
-		//log.Printf("[%v] -> Redirected to key[%v] at %v\n", h.addr, key, p)
 		// 在其他节点（机器），获得该节点的 Get 方法，进行 http 调用获取结果
 		return p, h.httpGetters[p], true
 	}
@@ -147,17 +403,119 @@ func (h *HTTPPool) Addr() string {
 	return h.addr
 }
 
-func (h *HTTPPool) Set(peers ...string) {
-	if h.peers == nil {
-		h.peers = consistenthash.New(h.replicas, h.hashFunc)
+// Peers 返回集群中的所有节点（包括当前节点），按地址排序
+func (h *HTTPPool) Peers() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	peers := make([]string, 0, len(h.httpGetters))
+	for addr := range h.httpGetters {
+		peers = append(peers, addr)
 	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Set 设置集群中的所有节点（包括当前节点），会用 peers 替换掉之前设置的节点，
+// 仍然存在的节点会保留其 httpGetter（以及熔断器状态）
+func (h *HTTPPool) Set(peers ...string) {
+	// 域名在加锁之前解析，解析较慢时不会阻塞请求
+	ips := h.resolvePeers(peers)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.peerIPs = ips
+	h.peers = consistenthash.New(h.replicas, h.hashFunc)
 	h.peers.Add(peers...)
-	if h.httpGetters == nil {
-		h.httpGetters = make(map[string]PeerGetter)
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, peer := range peers {
+		if getter, ok := h.httpGetters[peer]; ok {
+			getters[peer] = getter
+			continue
+		}
+		getters[peer] = &httpGetter{
+			host:    peer,
+			baseURL: h.baseURL,
+			client:  &http.Client{Timeout: h.peerTimeout},
+			breaker: newCircuitBreaker(h.breakerCfg),
+			outbox:  newOutbox(),
+		}
+	}
+	// 离开哈希环的节点不再需要待发送的失效通知
+	for peer, getter := range h.httpGetters {
+		if _, ok := getters[peer]; !ok && getter.outbox != nil {
+			getter.outbox.close()
+		}
 	}
+	h.httpGetters = getters
+}
+
+// resolvePeers 返回 peers 的所有 IP，解析失败的节点会被忽略，来自它的 generation 不会被接受
+func (h *HTTPPool) resolvePeers(peers []string) map[string]bool {
+	ips := make(map[string]bool, len(peers))
 	for _, peer := range peers {
-		h.httpGetters[peer] = &httpGetter{host: peer}
+		host, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			host = peer
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ips[ip.String()] = true
+			continue
+		}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			h.logger.Warn("resolve peer failed", "node", h.addr, "peer", peer, "err", err)
+			continue
+		}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil {
+				ips[ip.String()] = true
+			}
+		}
 	}
+	return ips
+}
+
+// trustGeneration 返回是否接受 r 中携带的 generation：请求来自哈希环中节点的 IP，或者开启了管理接口
+func (h *HTTPPool) trustGeneration(r *http.Request) bool {
+	if h.generationAdmin {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.peerIPs[ip.String()]
+}
+
+// Watch 通过 d 发现集群节点，每次节点变化时都会调用 Set 更新哈希环，
+// 该方法会一直阻塞，直到 ctx 被取消或者 d 返回错误
+func (h *HTTPPool) Watch(ctx context.Context, d Discovery) error {
+	return d.Watch(ctx, func(peers []string) {
+		h.logger.Info("peers changed", "node", h.addr, "peers", peers)
+		h.Set(peers...)
+	})
+}
+
+// PoolStats 是 HTTPPool 的统计信息
+type PoolStats struct {
+	// Peers 是每个远程节点的熔断器状态，key 为节点地址
+	Peers map[string]BreakerStats
+}
+
+// Stats 返回当前所有远程节点的熔断器状态
+func (h *HTTPPool) Stats() PoolStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	stats := PoolStats{Peers: make(map[string]BreakerStats, len(h.httpGetters))}
+	for addr, getter := range h.httpGetters {
+		stats.Peers[addr] = getter.breaker.stats()
+	}
+	return stats
 }
 
 // 默认请求 url 格式为：<scheme>://<host>/<baseURL>/<groupName>/<key>
@@ -165,9 +523,108 @@ type httpGetter struct {
 	scheme  string // http or https
 	host    string
 	baseURL string
+	client  *http.Client
+	breaker *circuitBreaker // 为 nil 时不启用熔断
+	outbox  *outbox         // 没有送达的失效通知，为 nil 时不在后台重试
 }
 
 func (h *httpGetter) Get(in *cachepb.Request, out *cachepb.Response) error {
+	// 熔断器打开时直接返回，不再等待一个注定失败的请求
+	if h.breaker != nil && !h.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	peerFailed, err := h.get(in, out)
+	if h.breaker != nil {
+		if peerFailed {
+			h.breaker.onFailure()
+		} else {
+			h.breaker.onSuccess()
+		}
+	}
+	return err
+}
+
+// get 发起实际的 http 请求，peerFailed 表示错误是否说明远程节点出了问题
+// （网络错误、超时、5xx 等），只有这类错误才会计入熔断器
+func (h *httpGetter) get(in *cachepb.Request, out *cachepb.Response) (peerFailed bool, err error) {
+	// 将整个 Request 放在请求体中发送，包括支持的压缩算法和所知道的 generation，
+	// key 不需要经过 URL 转义，任意字节都可以原样传递
+	msg := in
+	if !utf8.ValidString(in.Key) {
+		msg = proto.Clone(in).(*cachepb.Request)
+		msg.Key, msg.KeyBytes = "", []byte(in.Key)
+	}
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.url(nil, in.Group), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if in.TraceParent != "" {
+		req.Header.Set(traceHeader, in.TraceParent)
+	}
+	if in.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", in.IfNoneMatch)
+	}
+	res, body, peerFailed, err := h.do(req)
+	if err != nil {
+		return peerFailed, err
+	}
+	if res.StatusCode == http.StatusNotModified {
+		// 值没有变化，只根据 Cache-Control 更新过期时间，没有 max-age 表示永不过期
+		out.NotModified = true
+		if d, ok := parseMaxAge(res.Header.Get("Cache-Control")); ok {
+			out.Expire = time.Now().Add(d).UnixNano()
+		}
+		return false, nil
+	}
+	return false, proto.Unmarshal(body, out)
+}
+
+// do 发送请求并读取响应体，返回的 res 的 Body 已经关闭。没有得到响应时返回 unavailableError，
+// 200 和 304 以外的响应转换为 PeerError，peerFailed 的含义与 get 相同
+func (h *httpGetter) do(req *http.Request) (res *http.Response, body []byte, peerFailed bool, err error) {
+	res, err = h.httpClient().Do(req)
+	if err != nil {
+		return nil, nil, true, unavailableError(h.host, err)
+	}
+	defer res.Body.Close()
+
+	body, err = io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, true, unavailableError(h.host, fmt.Errorf("reading response body: %w", err))
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotModified {
+		pe := readError(h.host, res, body)
+		return nil, nil, !expectedCodes[pe.Code], pe
+	}
+	return res, body, false, nil
+}
+
+// expectedCodes 是远程节点正常处理请求得到的结果，说明节点本身是可用的，不计入熔断器
+var expectedCodes = map[string]bool{
+	codeNotFound:        true,
+	codeGroupNotFound:   true,
+	codeVersionConflict: true,
+	codeLoadThrottled:   true,
+}
+
+// publishGeneration 通知对方 group 的新 generation
+func (h *httpGetter) publishGeneration(group string, gen uint64) error {
+	query := url.Values{generationParam: {strconv.FormatUint(gen, 10)}}
+	req, err := http.NewRequest(http.MethodPost, h.url(query, generationPath, group), nil)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = h.do(req)
+	return err
+}
+
+// url 返回 <scheme>://<host>/<baseURL>/<elems...>?<query>，elems 中的每一项都会被转义
+func (h *httpGetter) url(query url.Values, elems ...string) string {
 	if h.scheme == "" {
 		h.scheme = "http"
 	}
@@ -179,40 +636,38 @@ func (h *httpGetter) Get(in *cachepb.Request, out *cachepb.Response) error {
 	}
 	// 因为 path.Join 不能适用于 URL 的格式，所以只能拼接 scheme 后面的部分
 	// （path.Join 会把 scheme://a/b 变为 scheme:/a/b）
-	p := path.Join(h.host,
-		h.baseURL,
-		url.QueryEscape(in.Group),
-		url.QueryEscape(in.Key))
+	// 转义后的 elems 不能再经过 path.Join，否则 %2F 等转义会被破坏
+	p := path.Join(h.host, h.baseURL)
 	// 因为 URL 的形式是 scheme://p，所以 p 不能以 '/' 开头，不然就成了 scheme:///p
 	if p[0] == '/' {
 		p = p[1:]
 	}
+	for _, e := range elems {
+		p += "/" + url.PathEscape(e)
+	}
 	// ps: go1.19 将会在 net/url 添加一个有用的函数 JoinPath 来解决上面的问题
 	u := fmt.Sprintf("%v://%v", h.scheme, p)
-	res, err := http.Get(u)
-	if err != nil {
-		log.Println("http get error: ", err)
-		return err
+	if len(query) > 0 {
+		u += "?" + query.Encode()
 	}
-	defer res.Body.Close()
+	return u
+}
 
-	if res.StatusCode != http.StatusOK {
-		log.Printf("server returned: %v", res.Status)
-		return fmt.Errorf("server returned: %v", res.Status)
+func (h *httpGetter) httpClient() *http.Client {
+	if h.client == nil {
+		return http.DefaultClient
 	}
+	return h.client
+}
 
-	bytes, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Printf("reading response body: %v", err)
-		return fmt.Errorf("reading response body: %v", err)
-	}
+var _ PeerGetter = (*httpGetter)(nil)
+var _ GenerationPublisher = (*HTTPPool)(nil)
 
-	if err := proto.Unmarshal(bytes, out); err != nil {
-		log.Println("proto unmarshal error: ", err)
-		return err
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
 	}
-
-	return nil
+	return false
 }
-
-var _ PeerGetter = (*httpGetter)(nil)
@@ -0,0 +1,157 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"void.io/x/cache/pb/cachepb"
+)
+
+type staticDiscovery []string
+
+func (d staticDiscovery) Watch(ctx context.Context, update func(peers []string)) error {
+	update(d)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHTTPPoolSet(t *testing.T) {
+	pool := NewHTTPPool("127.0.0.1", "10001")
+	pool.Set("127.0.0.1:10001", "127.0.0.1:10002", "127.0.0.1:10003")
+	old := pool.httpGetters["127.0.0.1:10002"]
+
+	// Set 会替换掉之前的节点，仍然存在的节点保留原来的 httpGetter
+	pool.Set("127.0.0.1:10001", "127.0.0.1:10002")
+	if len(pool.httpGetters) != 2 {
+		t.Fatalf("removed peer should be dropped, got %v", len(pool.httpGetters))
+	}
+	if pool.httpGetters["127.0.0.1:10002"] != old {
+		t.Fatal("existing peer should keep its httpGetter")
+	}
+	for i := 0; i < 100; i++ {
+		if addr, _, _ := pool.PickPeer(string(rune('a' + i))); addr == "127.0.0.1:10003" {
+			t.Fatal("removed peer should not be picked")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.Watch(ctx, staticDiscovery{"127.0.0.1:10001"})
+	}()
+	cancel()
+	<-done
+	if addr, _, notSelf := pool.PickPeer("a"); addr != "127.0.0.1:10001" || notSelf {
+		t.Fatalf("all keys should belong to self after discovery update, got %v", addr)
+	}
+}
+
+func TestServeHTTPBadRequest(t *testing.T) {
+	pool := NewHTTPPool("127.0.0.1", "10001", WithRegistry(NewRegistry()), WithPoolLogger(&recordLogger{}))
+	for _, p := range []string{"/other/g/k", "/groupcache/nokey", "/groupcache/"} {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com"+p, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%v: want 400, got %v %v", p, w.Code, w.Body)
+		}
+	}
+}
+
+func TestServeHTTPRequestTooLarge(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGroup("large", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	pool := NewHTTPPool("127.0.0.1", "10001", WithRegistry(registry))
+	body := bytes.Repeat([]byte{0}, maxRequestBytes+1)
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://example.com/groupcache/large", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want 400 for an oversized body, got %v", w.Code)
+	}
+}
+
+func TestServeHTTPRecover(t *testing.T) {
+	logger := &recordLogger{}
+	registry := NewRegistry()
+	registry.NewGroup("panic", 1024, GetterFunc(func(key string) ([]byte, error) {
+		panic("getter bug")
+	}))
+	pool := NewHTTPPool("127.0.0.1", "10001", WithRegistry(registry), WithPoolLogger(logger))
+
+	// 同一个 key 第二次请求也要返回，而不是阻塞在上一次 panic 的 singleflight 上
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/groupcache/panic/k", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("want 500, got %v", w.Code)
+		}
+	}
+	if !logger.has("panic serving request") {
+		t.Fatal("panic should be logged")
+	}
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	peer := startKeyEchoServer(t)
+	keys := []string{"a b", "a/b", "a+b", "/a/", ".", "..", "../a", "a?b#c", "%2F", "\x00\xff"}
+	for _, key := range keys {
+		checkKeyRoundTrip(t, peer, key)
+	}
+	// Set 同样通过请求体传递 key
+	for _, key := range keys {
+		in := &cachepb.SetRequest{Group: "echo", Key: key, Value: []byte("set " + key)}
+		if err := peer.Set(in, &cachepb.SetResponse{}); err != nil {
+			t.Fatalf("set %q: %v", key, err)
+		}
+		out := &cachepb.Response{}
+		if err := peer.Get(&cachepb.Request{Group: "echo", Key: key}, out); err != nil || string(out.Value) != "set "+key {
+			t.Fatalf("get %q after set: %q %v", key, out.Value, err)
+		}
+	}
+}
+
+func FuzzKeyRoundTrip(f *testing.F) {
+	peer := startKeyEchoServer(f)
+	for _, key := range []string{"k", "a b", "a/b", "a+b", "..", "%zz", "\x00\xff\xfe"} {
+		f.Add(key)
+	}
+	f.Fuzz(func(t *testing.T, key string) {
+		if key == "" {
+			t.Skip("empty key is not allowed")
+		}
+		checkKeyRoundTrip(t, peer, key)
+	})
+}
+
+// startKeyEchoServer 启动一个挂在 ServeMux 上的节点，Getter 原样返回 key
+func startKeyEchoServer(t testing.TB) *httpGetter {
+	registry := NewRegistry()
+	registry.NewGroup("echo", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	host, port, _ := net.SplitHostPort(addr)
+	mux.Handle(defaultUrl, NewHTTPPool(host, port, WithRegistry(registry)))
+	return &httpGetter{host: addr, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func checkKeyRoundTrip(t testing.TB, peer *httpGetter, key string) {
+	out := &cachepb.Response{}
+	if err := peer.Get(&cachepb.Request{Group: "echo", Key: key}, out); err != nil {
+		t.Fatalf("key %q: %v", key, err)
+	}
+	if !bytes.Equal(out.Value, []byte(key)) {
+		t.Fatalf("key %q: got %q", key, out.Value)
+	}
+}
@@ -0,0 +1,377 @@
+package groupcache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// invalidatePath 是接收失效通知的路径：POST <baseURL>/_invalidate/<groupName>?key=<key>&id=<eventID>，
+// 也兼容 POST <baseURL>/_invalidate/<groupName>/<key>?id=<eventID>
+const invalidatePath = "_invalidate"
+
+// keyParam 是失效通知的 key，放在 query 参数中，任意字节都可以原样传递
+const keyParam = "key"
+
+// eventIDParam 是失效通知的事件 ID，接收方据此去重
+const eventIDParam = "id"
+
+const (
+	// DefaultInvalidationAttempts 默认每个节点最多尝试发送失效通知的次数
+	DefaultInvalidationAttempts = 3
+	// DefaultInvalidationBackoff 默认第一次重试前等待的时间，之后每次重试翻倍
+	DefaultInvalidationBackoff = 100 * time.Millisecond
+)
+
+// invalidationDedupSize 每个节点记住的最近的事件 ID 数量
+const invalidationDedupSize = 4096
+
+// maxInvalidationBackoff 是后台重试失效通知的最长间隔
+const maxInvalidationBackoff = 30 * time.Second
+
+// maxPendingInvalidations 是每个节点最多保留的未送达的失效通知数量，同一个 key 只保留最新的一条
+const maxPendingInvalidations = 1 << 16
+
+// Invalidator 是 PeerPicker 可以选择实现的接口，实现了该接口时，
+// Group.Invalidate 会将失效通知发送给集群中的其他所有节点
+type Invalidator interface {
+	PublishInvalidation(group, key string) error
+}
+
+// WithInvalidationRetry 指定发送失效通知时每个节点最多尝试的次数，以及第一次重试前等待的时间
+func WithInvalidationRetry(attempts int, backoff time.Duration) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.invalidateAttempts = attempts
+		pool.invalidateBackoff = backoff
+	}
+}
+
+// epochSlots 是失效纪元的槽数，不同的 key 落在同一个槽时只会多丢弃一些加载结果
+const epochSlots = 256
+
+// Invalidate 删除集群中所有节点上 key 的缓存：先删除当前节点的缓存，
+// 如果 peers 实现了 Invalidator，再通知其他所有节点删除，返回的错误是通知失败的错误。
+// 删除时正在进行的加载（可能读到了旧的数据）完成后不会再把结果添加到缓存中。
+//
+// 通知至少送达一次：同步重试之后仍然失败的通知会保存在该节点的待发送队列中，由后台持续重试，
+// 直到对方确认或者该节点离开哈希环。待发送的通知只保存在内存中，发送方重启时会丢失，
+// 之后才加入集群的节点也收不到，需要更强的保证时，应同时设置过期时间，或者使用 BumpGeneration 使所有旧缓存失效
+func (g *Group) Invalidate(key string) error {
+	g.Remove(key)
+	if p, ok := g.peers.(Invalidator); ok {
+		return p.PublishInvalidation(g.name, key)
+	}
+	return nil
+}
+
+// invalidationEpoch 返回 key 当前的失效纪元，每次删除 key 都会增加，加载开始前读取，
+// 添加结果时纪元已经变化说明加载期间 key 被删除了，结果可能是旧的
+func (g *Group) invalidationEpoch(key string) uint64 {
+	return atomic.LoadUint64(&g.epochs[epochSlot(key)])
+}
+
+func (g *Group) bumpEpoch(key string) {
+	atomic.AddUint64(&g.epochs[epochSlot(key)], 1)
+}
+
+// addLoaded 将开始于 epoch 的加载结果添加到缓存，加载期间 key 被删除或者被写入时丢弃结果。
+// 纪元在持有 cache 的锁时检查：删除和写入都先增加纪元再修改缓存，
+// 检查发生在增加之前时，加载的结果会被之后的删除或写入覆盖，发生在之后时结果被丢弃
+func (g *Group) addLoaded(ck string, epoch uint64, val *ByteView) {
+	key := userKey(ck)
+	added := g.mainCache.addIf(ck, val, func() bool {
+		return g.invalidationEpoch(key) == epoch
+	})
+	if !added {
+		g.logger.Debug("drop load invalidated in flight", "node", g.addr(), "group", g.name, "key", key)
+	}
+}
+
+// epochSlot 返回 key 所在的槽（FNV-1a）
+func epochSlot(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % epochSlots)
+}
+
+// PublishInvalidation 将 group/key 的失效通知发送给除自己以外的所有节点，每个通知有唯一的事件 ID，
+// 发送失败时会重试，所以同一个节点可能收到多次同样的通知（至少一次），接收方根据事件 ID 去重。
+// 所有节点都尝试完毕后才会返回，返回的错误包含所有重试之后仍然失败的节点，
+// 这些节点的通知会放入待发送队列，在后台继续重试
+func (h *HTTPPool) PublishInvalidation(group, key string) error {
+	id, err := newEventID()
+	if err != nil {
+		return err
+	}
+	ev := invalidation{group: group, key: key, id: id}
+
+	h.mu.RLock()
+	getters := make([]*httpGetter, 0, len(h.httpGetters))
+	for addr, getter := range h.httpGetters {
+		if addr != h.addr {
+			getters = append(getters, getter)
+		}
+	}
+	h.mu.RUnlock()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for _, getter := range getters {
+		wg.Add(1)
+		go func(getter *httpGetter) {
+			defer wg.Done()
+			backoff := h.invalidateBackoff
+			var err error
+			for attempt := 1; attempt <= h.invalidateAttempts; attempt++ {
+				if err = getter.invalidate(group, key, id); err == nil {
+					return
+				}
+				if attempt < h.invalidateAttempts {
+					time.Sleep(backoff)
+					backoff *= 2
+				}
+			}
+			h.logger.Warn("publish invalidation failed, retrying in background", "node", h.addr, "group", group,
+				"key", key, "peer", getter.host, "id", id, "err", err)
+			h.enqueueInvalidation(getter, ev)
+			mu.Lock()
+			failed = append(failed, fmt.Sprintf("%v: %v", getter.host, err))
+			mu.Unlock()
+		}(getter)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("publish invalidation of %v/%v: %v", group, key, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// enqueueInvalidation 将没有送达 getter 的通知放入它的待发送队列，需要时启动后台重试
+func (h *HTTPPool) enqueueInvalidation(getter *httpGetter, ev invalidation) {
+	if getter.outbox == nil {
+		return
+	}
+	start, ok := getter.outbox.add(ev)
+	if !ok {
+		h.logger.Error("invalidation outbox full, dropped", "node", h.addr, "group", ev.group, "key", ev.key,
+			"peer", getter.host, "id", ev.id)
+	}
+	if start {
+		go h.retryInvalidations(getter)
+	}
+}
+
+// retryInvalidations 在后台重试 getter 待发送的通知，间隔从 invalidateBackoff 开始翻倍，
+// 最长为 maxInvalidationBackoff，队列为空或者节点离开哈希环时退出
+func (h *HTTPPool) retryInvalidations(getter *httpGetter) {
+	o := getter.outbox
+	backoff := h.invalidateBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-o.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delivered := 0
+		for _, ev := range o.list() {
+			if err := getter.invalidate(ev.group, ev.key, ev.id); err != nil {
+				h.logger.Debug("retry invalidation failed", "node", h.addr, "peer", getter.host, "err", err)
+				break
+			}
+			o.ack(ev)
+			delivered++
+		}
+		if o.finish() {
+			h.logger.Info("pending invalidations delivered", "node", h.addr, "peer", getter.host)
+			return
+		}
+		if delivered > 0 {
+			backoff = h.invalidateBackoff
+		} else if backoff *= 2; backoff > maxInvalidationBackoff {
+			backoff = maxInvalidationBackoff
+		}
+	}
+}
+
+// serveInvalidation 处理其他节点发来的失效通知，rest 为转义后的 <groupName> 或者 <groupName>/<key>
+func (h *HTTPPool) serveInvalidation(w http.ResponseWriter, r *http.Request, rest string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var groupName, key string
+	var err error
+	if strings.Contains(rest, "/") {
+		groupName, key, err = splitPath(rest)
+	} else {
+		groupName, err = url.PathUnescape(rest)
+		key = r.URL.Query().Get(keyParam)
+	}
+	if err != nil {
+		writeErrorCode(w, codeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	group := h.registry.GetGroup(groupName)
+	if group == nil {
+		writeError(w, fmt.Errorf("%w: %v", ErrGroupNotFound, groupName))
+		return
+	}
+	id := r.URL.Query().Get(eventIDParam)
+	if id == "" {
+		writeErrorCode(w, codeBadRequest, http.StatusBadRequest, "event id is required")
+		return
+	}
+	// 重复的通知同样返回成功，发送方才不会继续重试
+	if h.seenEvents.add(id) {
+		group.Remove(key)
+		h.logger.Debug("invalidated", "node", h.addr, "group", groupName, "key", key, "id", id)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// invalidate 向对方发送失效通知
+func (h *httpGetter) invalidate(group, key, id string) error {
+	query := url.Values{keyParam: {key}, eventIDParam: {id}}
+	req, err := http.NewRequest(http.MethodPost, h.url(query, invalidatePath, group), nil)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = h.do(req)
+	return err
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// eventDedup 记住最近 size 个事件 ID，用于丢弃重复的通知
+type eventDedup struct {
+	mu    sync.Mutex
+	size  int
+	seen  map[string]struct{}
+	order []string // 环形缓冲区，记录事件 ID 的到达顺序，满了之后覆盖最早的
+	next  int
+}
+
+func newEventDedup(size int) *eventDedup {
+	return &eventDedup{size: size, seen: make(map[string]struct{}, size)}
+}
+
+// add 记录事件 ID，第一次见到该 ID 时返回 true
+func (d *eventDedup) add(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[id]; ok {
+		return false
+	}
+	if len(d.order) < d.size {
+		d.order = append(d.order, id)
+	} else {
+		delete(d.seen, d.order[d.next])
+		d.order[d.next] = id
+		d.next = (d.next + 1) % d.size
+	}
+	d.seen[id] = struct{}{}
+	return true
+}
+
+// invalidation 是一条失效通知
+type invalidation struct {
+	group, key, id string
+}
+
+// outbox 是发送给一个节点但还没有被确认的失效通知，同一个 key 只保留最新的一条
+type outbox struct {
+	mu      sync.Mutex
+	pending map[string]invalidation // key 为 <group>\x00<key>
+	running bool                    // 是否有后台 goroutine 正在重试
+	closed  bool
+	done    chan struct{} // 节点离开哈希环时关闭
+}
+
+func newOutbox() *outbox {
+	return &outbox{pending: make(map[string]invalidation), done: make(chan struct{})}
+}
+
+// add 放入 ev，start 表示调用者需要启动后台重试，队列已满时 ok 为 false
+func (o *outbox) add(ev invalidation) (start, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return false, true
+	}
+	k := ev.group + "\x00" + ev.key
+	if _, exists := o.pending[k]; !exists && len(o.pending) >= maxPendingInvalidations {
+		return false, false
+	}
+	o.pending[k] = ev
+	start = !o.running
+	o.running = true
+	return start, true
+}
+
+// list 返回所有待发送的通知
+func (o *outbox) list() []invalidation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events := make([]invalidation, 0, len(o.pending))
+	for _, ev := range o.pending {
+		events = append(events, ev)
+	}
+	return events
+}
+
+// ack 删除已经送达的 ev，发送期间同一个 key 有了新的通知时保留新的
+func (o *outbox) ack(ev invalidation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	k := ev.group + "\x00" + ev.key
+	if o.pending[k].id == ev.id {
+		delete(o.pending, k)
+	}
+}
+
+// finish 在队列为空时结束后台重试并返回 true
+func (o *outbox) finish() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending) > 0 && !o.closed {
+		return false
+	}
+	o.running = false
+	return true
+}
+
+// close 在节点离开哈希环时调用，丢弃所有待发送的通知并停止后台重试
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.pending = nil
+	close(o.done)
+}
+
+var _ Invalidator = (*HTTPPool)(nil)
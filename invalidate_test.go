@@ -0,0 +1,152 @@
+package groupcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInvalidate(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	a, poolA, addrA := startNode(t, "invalidate", getter)
+	b, poolB, addrB := startNode(t, "invalidate", getter)
+	poolA.invalidateBackoff = time.Millisecond
+
+	// 在加入集群之前各自加载，模拟每个节点都持有 key 的副本
+	a.Get("k")
+	b.Get("k")
+
+	// 第一次通知 b 失败，重试后成功
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		poolB.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	addrFlaky := strings.TrimPrefix(flaky.URL, "http://")
+	poolA.Set(addrA, addrFlaky)
+	if got := poolA.Peers(); len(got) != 2 {
+		t.Fatalf("want 2 peers, got %v", got)
+	}
+
+	if err := a.Invalidate("k"); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("want invalidation retried once, got %d calls", calls)
+	}
+	for _, g := range []*Group{a, b} {
+		if _, ok := g.mainCache.get(cacheKey(0, "k")); ok {
+			t.Fatalf("key should be invalidated on %v", g.addr())
+		}
+	}
+
+	// 节点不可达时返回错误，离开哈希环后不再重试
+	poolA.Set(addrA, addrB, "127.0.0.1:1")
+	unreachable := poolA.httpGetters["127.0.0.1:1"]
+	if err := a.Invalidate("k"); err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Fatalf("want error for unreachable peer, got %v", err)
+	}
+	poolA.Set(addrA, addrB)
+	select {
+	case <-unreachable.outbox.done:
+	default:
+		t.Fatal("outbox of a removed peer should be closed")
+	}
+}
+
+func TestInvalidationOutbox(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	a, poolA, addrA := startNode(t, "invalidate-outbox", getter)
+	b, poolB, _ := startNode(t, "invalidate-outbox", getter)
+	WithInvalidationRetry(1, time.Millisecond)(poolA)
+	a.Get("k")
+	b.Get("k")
+
+	// b 一开始不可用，恢复之后收到后台重试的通知
+	var down int32 = 1
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		poolB.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	poolA.Set(addrA, strings.TrimPrefix(flaky.URL, "http://"))
+	defer poolA.Set(addrA)
+
+	if err := a.Invalidate("k"); err == nil {
+		t.Fatal("want error while the peer is down")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := b.mainCache.get(cacheKey(0, "k")); !ok {
+		t.Fatal("peer should not be invalidated while it is down")
+	}
+	atomic.StoreInt32(&down, 0)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if _, ok := b.mainCache.get(cacheKey(0, "k")); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pending invalidation should be delivered after the peer recovers")
+		}
+	}
+}
+
+func TestEventDedup(t *testing.T) {
+	d := newEventDedup(2)
+	if !d.add("1") || d.add("1") {
+		t.Fatal("duplicated event should be dropped")
+	}
+	d.add("2")
+	d.add("3") // 淘汰最早的 1
+	if !d.add("1") || d.add("3") {
+		t.Fatal("only the latest events should be remembered")
+	}
+}
+
+func TestInvalidateInFlightLoad(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	loads := 0
+	group := NewRegistry().NewGroup("invalidate-inflight", 1024, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if loads == 1 {
+			close(loading)
+			<-release
+			return []byte("old"), nil
+		}
+		return []byte("new"), nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := group.Get("a")
+		done <- err
+	}()
+	<-loading
+	// 加载开始之后 key 被删除，加载读到的可能是旧的数据，不能再添加到缓存中
+	if err := group.Invalidate("a"); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := group.mainCache.peek(cacheKey(0, "a")); ok {
+		t.Fatal("load invalidated in flight should not be cached")
+	}
+	if val, err := group.Get("a"); err != nil || val.String() != "new" {
+		t.Fatalf("want a fresh load, got %v, %v", val, err)
+	}
+}
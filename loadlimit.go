@@ -0,0 +1,130 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLoadThrottled 表示调用 Getter 的速率或者并发数超出了限制
+var ErrLoadThrottled = errors.New("groupcache: load throttled")
+
+// WithLoadRate 限制每秒调用 Getter 的次数（令牌桶），burst 为允许的突发次数，小于 1 时按 1 处理。
+// 超出限制时，如果 GetContext 的 ctx 设置了截止时间，会等待到截止时间为止，否则立即返回 ErrLoadThrottled
+func WithLoadRate(perSecond float64, burst int) GroupOption {
+	return func(g *Group) {
+		if burst < 1 {
+			burst = 1
+		}
+		g.loadRate = newTokenBucket(perSecond, burst)
+	}
+}
+
+// WithLoadConcurrency 限制同时调用 Getter 的最大数量，小于 1 时按 1 处理，超出限制时的行为与 WithLoadRate 相同
+func WithLoadConcurrency(n int) GroupOption {
+	return func(g *Group) {
+		if n < 1 {
+			n = 1
+		}
+		g.loadSem = make(chan struct{}, n)
+	}
+}
+
+// acquireLoad 在调用 Getter 之前调用，超出限制时，如果 ctx 设置了截止时间，会等待到截止时间为止，
+// 否则立即返回 ErrLoadThrottled。同一个 key 的并发加载会合并，所以使用的是第一个调用者的 ctx。
+// 返回 nil 时调用者结束后必须调用 releaseLoad
+func (g *Group) acquireLoad(ctx context.Context) error {
+	deadline, wait := ctx.Deadline()
+	if g.loadRate != nil {
+		var maxWait time.Duration
+		if wait {
+			maxWait = time.Until(deadline)
+		}
+		d, ok := g.loadRate.reserve(time.Now(), maxWait)
+		if !ok {
+			atomic.AddInt64(&g.stats.loadsThrottled, 1)
+			return ErrLoadThrottled
+		}
+		if d > 0 {
+			atomic.AddInt64(&g.stats.loadsWaited, 1)
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				// 已经预留的令牌不再归还，相当于这次加载消耗了额度
+				timer.Stop()
+				atomic.AddInt64(&g.stats.loadsThrottled, 1)
+				return ErrLoadThrottled
+			}
+		}
+	}
+	if g.loadSem != nil {
+		select {
+		case g.loadSem <- struct{}{}:
+			return nil
+		default:
+		}
+		if !wait {
+			atomic.AddInt64(&g.stats.loadsThrottled, 1)
+			return ErrLoadThrottled
+		}
+		atomic.AddInt64(&g.stats.loadsWaited, 1)
+		select {
+		case g.loadSem <- struct{}{}:
+		case <-ctx.Done():
+			atomic.AddInt64(&g.stats.loadsThrottled, 1)
+			return ErrLoadThrottled
+		}
+	}
+	return nil
+}
+
+func (g *Group) releaseLoad() {
+	if g.loadSem != nil {
+		<-g.loadSem
+	}
+}
+
+// tokenBucket 是一个令牌桶，每秒生成 rate 个令牌，最多存放 burst 个
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve 预留一个令牌，返回需要等待多久才能使用该令牌，需要等待的时间超过 maxWait 时不预留，返回 false
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if b.rate <= 0 {
+		return 0, false
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	// 令牌数可以为负，表示已经被预留的令牌
+	b.tokens--
+	return wait, true
+}
@@ -0,0 +1,104 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if d, ok := b.reserve(now, 0); !ok || d != 0 {
+			t.Fatalf("burst %d should pass without waiting", i)
+		}
+	}
+	if _, ok := b.reserve(now, 0); ok {
+		t.Fatal("bucket should be empty")
+	}
+	if d, ok := b.reserve(now, time.Second); !ok || d != 100*time.Millisecond {
+		t.Fatalf("want to wait 100ms, got %v, %v", d, ok)
+	}
+	// 上一个令牌已经被预留，需要再等 100ms
+	if d, ok := b.reserve(now.Add(100*time.Millisecond), time.Second); !ok || d != 100*time.Millisecond {
+		t.Fatalf("want to wait 100ms, got %v, %v", d, ok)
+	}
+}
+
+func TestLoadRate(t *testing.T) {
+	group := NewGroup("load-rate", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithLoadRate(20, 1))
+	defer DeleteGroup("load-rate")
+
+	if _, err := group.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	// 没有截止时间，立即失败
+	if _, err := group.Get("b"); !errors.Is(err, ErrLoadThrottled) {
+		t.Fatalf("want ErrLoadThrottled, got %v", err)
+	}
+	// 有截止时间，等待令牌
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := group.GetContext(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	stats := group.Stats()
+	if stats.Loads != 2 || stats.LoadsWaited != 1 || stats.LoadsThrottled != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLoadConcurrency(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	group := NewGroup("load-concurrency", 1024, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			close(started)
+			<-release
+		}
+		return []byte(key), nil
+	}), WithLoadConcurrency(1))
+	defer DeleteGroup("load-concurrency")
+
+	done := make(chan error)
+	go func() {
+		_, err := group.Get("slow")
+		done <- err
+	}()
+	<-started
+
+	if _, err := group.Get("a"); !errors.Is(err, ErrLoadThrottled) {
+		t.Fatalf("want ErrLoadThrottled, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := group.GetContext(ctx, "a"); !errors.Is(err, ErrLoadThrottled) {
+		t.Fatalf("want ErrLoadThrottled after waiting, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := group.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := group.Stats(); stats.LoadsThrottled != 2 || stats.LoadsWaited != 1 || stats.CacheItems != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLoadConcurrencyNormalized(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	for _, n := range []int{0, -1} {
+		group := NewRegistry().NewGroup("load-concurrency-normalized", 1024, getter, WithLoadConcurrency(n))
+		if _, err := group.Get("a"); err != nil {
+			t.Fatalf("WithLoadConcurrency(%d) should allow one load, got %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package groupcache
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger 是分级的结构化日志接口，args 为交替出现的 key、value，
+// 与 log/slog 的约定相同，*slog.Logger 可以直接作为 Logger 使用。
+// 常用的 key 有 group、key、peer、node、latency、err
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// WithLogger 指定 Group 的日志，默认只通过标准库 log 输出错误
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// WithPoolLogger 指定 HTTPPool 的日志，默认只通过标准库 log 输出错误
+func WithPoolLogger(l Logger) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.logger = l
+	}
+}
+
+// DefaultLogger 是没有指定日志时使用的默认日志，只通过标准库 log 输出错误，避免在高 QPS 下每次命中都打印日志。
+// resp、gossip 等子包也使用它作为默认值，修改它会影响之后创建的所有对象
+var DefaultLogger Logger = stdLogger{}
+
+// stdLogger 通过标准库 log 输出 Error 级别的日志，其他级别的日志全部丢弃
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, args ...any) {}
+func (stdLogger) Info(msg string, args ...any)  {}
+func (stdLogger) Warn(msg string, args ...any)  {}
+
+func (stdLogger) Error(msg string, args ...any) {
+	log.Output(2, "ERROR "+formatLog(msg, args))
+}
+
+// formatLog 将 msg 和 args 格式化为 "msg k1=v1 k2=v2" 的形式
+func formatLog(msg string, args []any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+		}
+	}
+	return b.String()
+}
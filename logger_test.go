@@ -0,0 +1,72 @@
+package groupcache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordLogger 记录所有日志，用于测试
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordLogger) log(level, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, level+" "+formatLog(msg, args))
+}
+
+func (l *recordLogger) Debug(msg string, args ...any) { l.log("DEBUG", msg, args) }
+func (l *recordLogger) Info(msg string, args ...any)  { l.log("INFO", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.log("WARN", msg, args) }
+func (l *recordLogger) Error(msg string, args ...any) { l.log("ERROR", msg, args) }
+
+// has 返回是否有包含 s 的日志
+func (l *recordLogger) has(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if strings.Contains(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	logger := &recordLogger{}
+	group := NewGroup("logger", 1024, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("no such key")
+		}
+		return []byte(key), nil
+	}), WithLogger(logger))
+	defer DeleteGroup("logger")
+
+	group.Get("a")
+	group.Get("a")
+	group.Get("missing")
+
+	want := []string{
+		"DEBUG loaded from getter node=local group=logger key=a",
+		"DEBUG cache hit node=local group=logger key=a",
+		"DEBUG loaded from getter node=local group=logger key=missing",
+	}
+	if len(logger.entries) != len(want) {
+		t.Fatalf("want %d entries, got %q", len(want), logger.entries)
+	}
+	for i, prefix := range want {
+		if e := logger.entries[i]; len(e) < len(prefix) || e[:len(prefix)] != prefix {
+			t.Fatalf("entry %d: want prefix %q, got %q", i, prefix, e)
+		}
+	}
+}
+
+func TestFormatLog(t *testing.T) {
+	if s := formatLog("msg", []any{"k", 1, "odd"}); s != "msg k=1 !BADKEY=odd" {
+		t.Fatalf("unexpected format: %q", s)
+	}
+}
@@ -62,20 +62,47 @@ func (c *LRU) Add(key string, value Value) {
 	}
 }
 
+// Remove 删除 key 对应的缓存，同样会调用 OnEvicted
+func (c *LRU) Remove(key string) {
+	if v, ok := c.cache[key]; ok {
+		c.removeElement(v)
+	}
+}
+
 func (c *LRU) RemoveOldest() {
 	l := c.ll.Back()
 	if l != nil {
-		delete(c.cache, l.Value.(*entry).key)
-		c.ll.Remove(l)
-		lv := l.Value.(*entry)
-		c.curBytes -= int64(len(lv.key)) + lv.value.Len()
+		c.removeElement(l)
+	}
+}
 
-		if c.OnEvicted != nil {
-			c.OnEvicted(lv.key, lv.value)
+func (c *LRU) removeElement(l *list.Element) {
+	delete(c.cache, l.Value.(*entry).key)
+	c.ll.Remove(l)
+	lv := l.Value.(*entry)
+	c.curBytes -= int64(len(lv.key)) + lv.value.Len()
+
+	if c.OnEvicted != nil {
+		c.OnEvicted(lv.key, lv.value)
+	}
+}
+
+// Range 按照从最久未使用到最近使用的顺序遍历所有缓存，fn 返回 false 时停止遍历，
+// 遍历不会改变缓存的顺序
+func (c *LRU) Range(fn func(key string, value Value) bool) {
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		kv := e.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
 		}
 	}
 }
 
+// Bytes 返回当前占用的容量
+func (c *LRU) Bytes() int64 {
+	return c.curBytes
+}
+
 func (c *LRU) Len() int {
 	return c.ll.Len()
 }
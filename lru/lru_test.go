@@ -64,3 +64,38 @@ func TestLru(t *testing.T) {
 	fmt.Println(lru.Get("4"))
 	fmt.Println("========================================")
 }
+
+func TestRemove(t *testing.T) {
+	var evicted []string
+	lru := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("1", &Str{s: "111"})
+	lru.Add("2", &Str{s: "222"})
+
+	lru.Remove("1")
+	lru.Remove("3")
+	if _, ok := lru.Get("1"); ok || lru.Len() != 1 || lru.curBytes != 4 {
+		t.Fatalf("key 1 should be removed, len: %v, curBytes: %v", lru.Len(), lru.curBytes)
+	}
+	if len(evicted) != 1 || evicted[0] != "1" {
+		t.Fatalf("OnEvicted should be called for removed key, got %v", evicted)
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(0, nil)
+	lru.Add("1", &Str{s: "111"})
+	lru.Add("2", &Str{s: "222"})
+	lru.Add("3", &Str{s: "333"})
+	lru.Get("1")
+
+	var keys []string
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if fmt.Sprint(keys) != "[2 3 1]" {
+		t.Fatalf("Range should walk from oldest to newest, got %v", keys)
+	}
+}
@@ -1,6 +1,8 @@
 package groupcache
 
 import (
+	"context"
+
 	"void.io/x/cache/pb/cachepb"
 )
 
@@ -18,3 +20,11 @@ type PeerGetter interface {
 	// Get 用于从对应 group 查找缓存值
 	Get(in *cachepb.Request, out *cachepb.Response) error
 }
+
+// Discovery 用于发现集群中的节点，代替启动时通过 HTTPPool.Set 写死节点地址的方式，
+// 内置的实现见 discovery 包
+type Discovery interface {
+	// Watch 持续监听集群节点，每当节点集合发生变化时，以完整的节点列表调用 update，
+	// 该方法会一直阻塞，直到 ctx 被取消或者出现无法恢复的错误
+	Watch(ctx context.Context, update func(peers []string)) error
+}
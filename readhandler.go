@@ -0,0 +1,268 @@
+package groupcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"void.io/x/cache/pb/cachepb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultReadPath 是 ReadHandler 默认的路径前缀
+const defaultReadPath = "/cache/"
+
+// ReadHandler 返回的数据格式，由请求的 Accept 头决定
+const (
+	contentTypeRaw      = "application/octet-stream"
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// ReadHandler 响应中的元数据头，raw 格式只能通过这些头获取元数据
+const (
+	headerVersion = "X-Groupcache-Version"
+	headerStale   = "X-Groupcache-Stale"
+)
+
+type ReadHandlerOption func(h *ReadHandler)
+
+// WithReadBasePath 指定 ReadHandler 的路径前缀，默认为 /cache/
+func WithReadBasePath(p string) ReadHandlerOption {
+	return func(h *ReadHandler) {
+		h.basePath = p
+	}
+}
+
+// WithReadRegistry 指定从哪个 Registry 中查找 Group，默认为 DefaultRegistry
+func WithReadRegistry(r *Registry) ReadHandlerOption {
+	return func(h *ReadHandler) {
+		h.registry = r
+	}
+}
+
+// WithReadLogger 指定 ReadHandler 的日志，默认只通过标准库 log 输出错误
+func WithReadLogger(l Logger) ReadHandlerOption {
+	return func(h *ReadHandler) {
+		h.logger = l
+	}
+}
+
+// ReadHandler 是面向客户端（非 groupcache 节点）的只读 HTTP 接口，与节点之间通信的 HTTPPool 分开挂载：
+//
+//	GET  <basePath><groupName>/<key>        读取 key，key 需要按路径转义
+//	GET  <basePath><groupName>?key=<key>    同上，key 放在 query 参数中，可以是任意字节
+//	HEAD <basePath><groupName>/<key>        只返回响应头，用于判断 key 是否存在（不存在时会调用 Getter 加载）
+//
+// 根据 Accept 头返回以下格式之一，默认为原始的字节：
+//
+//	application/octet-stream  原始的值，版本号等元数据在 X-Groupcache-* 响应头中
+//	application/json          {"group","key","value","expire","stale","version"}，value 为 base64 编码
+//	application/x-protobuf    proto 编码的 cachepb.Response
+type ReadHandler struct {
+	basePath string
+	registry *Registry
+	logger   Logger
+}
+
+func NewReadHandler(opts ...ReadHandlerOption) *ReadHandler {
+	h := &ReadHandler{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.basePath == "" {
+		h.basePath = defaultReadPath
+	}
+	if h.registry == nil {
+		h.registry = DefaultRegistry
+	}
+	if h.logger == nil {
+		h.logger = DefaultLogger
+	}
+	return h
+}
+
+// readResponse 是 JSON 格式的响应
+type readResponse struct {
+	Group   string     `json:"group"`
+	Key     string     `json:"key"`
+	Value   []byte     `json:"value"`
+	Expire  *time.Time `json:"expire,omitempty"`
+	Stale   bool       `json:"stale,omitempty"`
+	Version uint64     `json:"version,omitempty"`
+}
+
+// readErrorResponse 是 JSON 格式的错误响应
+type readErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (h *ReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		h.writeError(w, r, contentTypeRaw, codeBadRequest, http.StatusNotAcceptable,
+			"supported types: "+strings.Join([]string{contentTypeRaw, contentTypeJSON, contentTypeProtobuf}, ", "))
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.writeError(w, r, contentType, codeBadRequest, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	p := r.URL.EscapedPath()
+	if !strings.HasPrefix(p, h.basePath) {
+		h.writeError(w, r, contentType, codeBadRequest, http.StatusNotFound, "request url need contain a base path: "+h.basePath)
+		return
+	}
+	var (
+		groupName, key string
+		err            error
+	)
+	if rest := p[len(h.basePath):]; strings.Contains(rest, "/") {
+		groupName, key, err = splitPath(rest)
+	} else {
+		groupName, err = url.PathUnescape(rest)
+		key = r.URL.Query().Get(keyParam)
+	}
+	if err != nil {
+		h.writeError(w, r, contentType, codeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	if key == "" {
+		h.writeError(w, r, contentType, codeBadRequest, http.StatusBadRequest, "key is required")
+		return
+	}
+	group := h.registry.GetGroup(groupName)
+	if group == nil {
+		h.writeErr(w, r, contentType, fmt.Errorf("%w: %v", ErrGroupNotFound, groupName))
+		return
+	}
+
+	val, err := group.GetContext(r.Context(), key)
+	if err != nil {
+		h.writeErr(w, r, contentType, err)
+		return
+	}
+
+	var body []byte
+	switch contentType {
+	case contentTypeJSON:
+		out := readResponse{Group: groupName, Key: key, Value: val.b, Stale: val.Stale(), Version: val.Version()}
+		if e := val.Expire(); !e.IsZero() {
+			out.Expire = &e
+		}
+		body, err = json.Marshal(out)
+	case contentTypeProtobuf:
+		out := &cachepb.Response{Value: val.b, Stale: val.Stale(), Generation: group.Generation(), Version: val.Version()}
+		if e := val.Expire(); !e.IsZero() {
+			out.Expire = e.UnixNano()
+		}
+		body, err = proto.Marshal(out)
+	default:
+		body = val.b
+	}
+	if err != nil {
+		h.logger.Error("marshal response failed", "group", groupName, "key", key, "err", err)
+		h.writeErr(w, r, contentType, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Vary", "Accept")
+	header.Set(headerVersion, strconv.FormatUint(val.Version(), 10))
+	if val.Stale() {
+		header.Set(headerStale, "true")
+	}
+	// 不同格式的响应体不同，ETag 也不同
+	if setCacheHeaders(header, r.Header.Get("If-None-Match"), val, readETag(contentType, val, group.Generation())) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// writeErr 将 err 按 errorCode 转换为状态码后写入响应
+func (h *ReadHandler) writeErr(w http.ResponseWriter, r *http.Request, contentType string, err error) {
+	code, status := errorCode(err)
+	h.writeError(w, r, contentType, code, status, err.Error())
+}
+
+// writeError 按照协商的格式写入错误：JSON 格式为 {"error":{"code","message"}}，
+// protobuf 格式为只包含 error 的 cachepb.Response，raw 格式为纯文本
+func (h *ReadHandler) writeError(w http.ResponseWriter, r *http.Request, contentType, code string, status int, message string) {
+	var body []byte
+	switch contentType {
+	case contentTypeJSON:
+		var out readErrorResponse
+		out.Error.Code, out.Error.Message = code, message
+		body, _ = json.Marshal(out)
+	case contentTypeProtobuf:
+		body, _ = proto.Marshal(&cachepb.Response{Error: &cachepb.Error{Code: code, Message: message}})
+	default:
+		contentType = "text/plain; charset=utf-8"
+		body = []byte(message + "\n")
+	}
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// negotiate 根据 Accept 头选择响应格式：选择 q 值最大的受支持的格式，q 值相同时优先选择没有通配符的，
+// 其次是先出现的，通配符对应 raw。Accept 为空时返回 raw，没有受支持的格式时返回 false
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeRaw, true
+	}
+	var (
+		best         string
+		bestQ        float64
+		bestSpecific bool
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var t string
+		specific := !strings.HasSuffix(mediaType, "/*")
+		switch mediaType {
+		case contentTypeRaw, "*/*", "application/*":
+			t = contentTypeRaw
+		case contentTypeJSON:
+			t = contentTypeJSON
+		case contentTypeProtobuf, "application/protobuf", "application/vnd.google.protobuf":
+			t = contentTypeProtobuf
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && q > 0 && specific && !bestSpecific) {
+			best, bestQ, bestSpecific = t, q, specific
+		}
+	}
+	return best, best != ""
+}
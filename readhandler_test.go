@@ -0,0 +1,101 @@
+package groupcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"void.io/x/cache/pb/cachepb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReadHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGroup("scores", 1024, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("value of " + key), nil
+	}), WithExpiration(time.Minute))
+	h := NewReadHandler(WithReadRegistry(registry))
+
+	serve := func(method, target, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/cache/scores/a%2Fb", "")
+	if w.Code != http.StatusOK || w.Body.String() != "value of a/b" || w.Header().Get("Content-Type") != contentTypeRaw {
+		t.Fatalf("raw: got %v %q %v", w.Code, w.Body, w.Header())
+	}
+	if w.Header().Get("Content-Length") != strconv.Itoa(len("value of a/b")) {
+		t.Fatalf("raw: bad Content-Length %q", w.Header().Get("Content-Length"))
+	}
+
+	w = serve(http.MethodGet, "/cache/scores?key=a+b", "text/html, application/json;q=0.9, */*;q=0.1")
+	var out readResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("json: %v %q", err, w.Body)
+	}
+	if out.Group != "scores" || out.Key != "a b" || string(out.Value) != "value of a b" || out.Expire == nil {
+		t.Fatalf("json: got %+v", out)
+	}
+
+	w = serve(http.MethodGet, "/cache/scores/c", "*/*, application/x-protobuf")
+	pb := &cachepb.Response{}
+	if err := proto.Unmarshal(w.Body.Bytes(), pb); err != nil || string(pb.Value) != "value of c" || pb.Expire == 0 {
+		t.Fatalf("protobuf: got %v %v", pb, err)
+	}
+
+	w = serve(http.MethodHead, "/cache/scores/c", "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != strconv.Itoa(len("value of c")) {
+		t.Fatalf("head: got %v %q %v", w.Code, w.Body, w.Header())
+	}
+	if w = serve(http.MethodHead, "/cache/scores/missing", ""); w.Code != http.StatusNotFound || w.Body.Len() != 0 {
+		t.Fatalf("head missing: got %v %q", w.Code, w.Body)
+	}
+
+	w = serve(http.MethodGet, "/cache/scores/missing", "application/json")
+	var e readErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != http.StatusNotFound || e.Error.Code != codeNotFound {
+		t.Fatalf("not found: got %v %q %v", w.Code, w.Body, err)
+	}
+	if w = serve(http.MethodGet, "/cache/nosuch/k", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("no group: got %v", w.Code)
+	}
+	if w = serve(http.MethodGet, "/cache/scores/c", "text/html"); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("not acceptable: got %v", w.Code)
+	}
+	if w = serve(http.MethodPost, "/cache/scores/c", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("post: got %v", w.Code)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept, want string
+	}{
+		{"", contentTypeRaw},
+		{"*/*", contentTypeRaw},
+		{"application/json", contentTypeJSON},
+		{"*/*, application/json", contentTypeJSON},
+		{"application/json;q=0.5, application/x-protobuf", contentTypeProtobuf},
+		{"application/protobuf, application/json", contentTypeProtobuf},
+		{"application/json;q=0, */*", contentTypeRaw},
+		{"text/plain", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := negotiate(tt.accept); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
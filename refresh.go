@@ -0,0 +1,110 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRefreshWorkers 默认的提前刷新 worker 数量
+const DefaultRefreshWorkers = 4
+
+// WithRefreshAhead 开启热点 key 的提前刷新：如果一个缓存自加载以来被访问了至少 minHits 次，
+// 并且距离过期不足 window，就会在后台提前刷新，避免热点 key 同时过期导致数据源压力骤增，
+// 只有设置了 WithExpiration 才会生效
+func WithRefreshAhead(window time.Duration, minHits int64) GroupOption {
+	return func(g *Group) {
+		g.refreshWindow = window
+		g.refreshMinHits = minHits
+	}
+}
+
+// WithRefreshWorkers 指定提前刷新的 worker 数量，也就是提前刷新对数据源的最大并发数
+func WithRefreshWorkers(n int) GroupOption {
+	return func(g *Group) {
+		g.refreshWorkers = n
+	}
+}
+
+// refresher 维护一个固定大小的 worker 池，负责在后台提前刷新热点 key
+type refresher struct {
+	g       *Group
+	window  time.Duration
+	minHits int64
+	workers int
+
+	once    sync.Once
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string]struct{} // 已经在队列中或者正在刷新的 key
+	stopped bool
+}
+
+func newRefresher(g *Group, window time.Duration, minHits int64, workers int) *refresher {
+	if workers <= 0 {
+		workers = DefaultRefreshWorkers
+	}
+	return &refresher{
+		g:       g,
+		window:  window,
+		minHits: minHits,
+		workers: workers,
+		queue:   make(chan string, workers*64),
+		pending: make(map[string]struct{}),
+	}
+}
+
+// touch 记录一次缓存命中，满足条件时将 key 加入刷新队列
+func (r *refresher) touch(key string, val *ByteView, now time.Time) {
+	hits := atomic.AddInt64(&val.hits, 1)
+	if val.e.IsZero() || hits < r.minHits || val.e.Sub(now) > r.window {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pending[key]; ok || r.stopped {
+		return
+	}
+
+	r.once.Do(r.start)
+	select {
+	case r.queue <- key:
+		r.pending[key] = struct{}{}
+	default:
+		// 队列已满，放弃这次刷新，等 key 过期后再正常加载
+	}
+}
+
+// stop 关闭刷新队列，worker 处理完队列中剩余的 key 后退出
+func (r *refresher) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.queue)
+	}
+}
+
+func (r *refresher) start() {
+	for i := 0; i < r.workers; i++ {
+		go r.work()
+	}
+}
+
+func (r *refresher) work() {
+	for key := range r.queue {
+		if _, err := r.g.load(context.Background(), key); err != nil && !errors.Is(err, ErrGroupClosed) {
+			r.g.logger.Error("refresh ahead failed", "node", r.g.addr(), "group", r.g.name, "key", key, "err", err)
+		}
+		r.done(key)
+	}
+}
+
+func (r *refresher) done(key string) {
+	r.mu.Lock()
+	delete(r.pending, key)
+	r.mu.Unlock()
+}
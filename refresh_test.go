@@ -0,0 +1,88 @@
+package groupcache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	var loads int64
+	group := NewGroup("refresh-ahead", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strconv.FormatInt(atomic.AddInt64(&loads, 1), 10)), nil
+	}), WithExpiration(200*time.Millisecond), WithRefreshAhead(150*time.Millisecond, 3))
+
+	group.Get("hot")
+	group.Get("cold")
+	time.Sleep(80 * time.Millisecond)
+
+	// hot 被频繁访问，且即将过期，会被提前刷新；cold 只访问了一次，不会被刷新
+	for i := 0; i < 3; i++ {
+		group.Get("hot")
+	}
+	group.Get("cold")
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for {
+		val, _ := group.Get("hot")
+		if val.String() == "3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hot key was not refreshed before expiry, got %v", val)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&loads); n != 3 {
+		t.Fatalf("want 3 loads, got %d", n)
+	}
+}
+
+func TestRefreshWorkersBound(t *testing.T) {
+	var (
+		mu                sync.Mutex
+		running, maxSeen  int
+		refreshing        int64
+		keys              = 20
+		ready             = make(chan struct{})
+		loadedInitialKeys int64
+	)
+	group := NewGroup("refresh-workers", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		if atomic.LoadInt64(&loadedInitialKeys) < int64(keys) {
+			atomic.AddInt64(&loadedInitialKeys, 1)
+			return []byte(key), nil
+		}
+		mu.Lock()
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if atomic.AddInt64(&refreshing, 1) == int64(keys) {
+			close(ready)
+		}
+		return []byte(key), nil
+	}), WithExpiration(time.Minute), WithRefreshAhead(time.Hour, 1), WithRefreshWorkers(2))
+
+	for i := 0; i < keys; i++ {
+		group.Get(strconv.Itoa(i))
+	}
+	for i := 0; i < keys; i++ {
+		group.Get(strconv.Itoa(i))
+	}
+
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("only %d of %d keys refreshed", atomic.LoadInt64(&refreshing), keys)
+	}
+	if maxSeen > 2 {
+		t.Fatalf("getter saw %d concurrent refreshes, want at most 2", maxSeen)
+	}
+}
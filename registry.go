@@ -0,0 +1,131 @@
+package groupcache
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry 保存一组 Group，同一个 Registry 中 Group 的名字唯一。
+// 不同的 Registry 互不影响，可以在同一个进程中运行多个相互独立的集群，
+// 包级别的 NewGroup、GetGroup 等函数使用的是 DefaultRegistry
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+// DefaultRegistry 是包级别函数所使用的 Registry
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// NewGroup 创建并注册一个 Group，同名的 Group 已经存在时会 panic，
+// 需要替换时先调用 DeleteGroup，或者使用返回错误的 CreateGroup
+func (r *Registry) NewGroup(name string, size int64, getter Getter, opts ...GroupOption) *Group {
+	g, err := r.CreateGroup(name, size, getter, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// CreateGroup 与 NewGroup 相同，但同名的 Group 已经存在时返回 ErrGroupExists。
+// Group 初始化（恢复快照、启动提前刷新等）完成之后才会被注册，GetGroup 不会拿到还没有初始化完的 Group
+func (r *Registry) CreateGroup(name string, size int64, getter Getter, opts ...GroupOption) (*Group, error) {
+	if r.GetGroup(name) != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGroupExists, name)
+	}
+	g := newGroup(name, size, getter, opts...)
+	g.registry = r
+	g.init()
+
+	// 初始化期间可能有同名的 Group 被并发创建，需要再检查一次
+	r.mu.Lock()
+	if _, ok := r.groups[name]; ok {
+		r.mu.Unlock()
+		g.release()
+		return nil, fmt.Errorf("%w: %v", ErrGroupExists, name)
+	}
+	r.groups[name] = g
+	r.mu.Unlock()
+	return g, nil
+}
+
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.groups[name]
+}
+
+// GroupNames 返回所有 Group 的名字，按名字排序
+func (r *Registry) GroupNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DeleteGroup 注销并关闭名为 name 的 Group，Group 不存在时什么也不做
+func (r *Registry) DeleteGroup(name string) error {
+	g := r.GetGroup(name)
+	if g == nil {
+		return nil
+	}
+	return g.Close()
+}
+
+// Shutdown 将所有指定了快照目录的 Group 保存到磁盘，应在进程优雅退出时调用，
+// 返回遇到的第一个错误
+func (r *Registry) Shutdown() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var first error
+	for _, g := range r.groups {
+		if err := g.SaveSnapshot(); err != nil {
+			g.logger.Error("save snapshot failed", "group", g.name, "err", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// remove 将 g 从 Registry 中移除，同名的已经是另一个 Group 时什么也不做
+func (r *Registry) remove(g *Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.groups[g.name] == g {
+		delete(r.groups, g.name)
+	}
+}
+
+// NewGroup 在 DefaultRegistry 中创建 Group，参见 Registry.NewGroup
+func NewGroup(name string, size int64, getter Getter, opts ...GroupOption) *Group {
+	return DefaultRegistry.NewGroup(name, size, getter, opts...)
+}
+
+// CreateGroup 在 DefaultRegistry 中创建 Group，参见 Registry.CreateGroup
+func CreateGroup(name string, size int64, getter Getter, opts ...GroupOption) (*Group, error) {
+	return DefaultRegistry.CreateGroup(name, size, getter, opts...)
+}
+
+func GetGroup(name string) *Group {
+	return DefaultRegistry.GetGroup(name)
+}
+
+// DeleteGroup 注销并关闭 DefaultRegistry 中名为 name 的 Group
+func DeleteGroup(name string) error {
+	return DefaultRegistry.DeleteGroup(name)
+}
+
+// Shutdown 保存 DefaultRegistry 中所有 Group 的快照，参见 Registry.Shutdown
+func Shutdown() error {
+	return DefaultRegistry.Shutdown()
+}
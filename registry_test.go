@@ -0,0 +1,99 @@
+package groupcache
+
+import (
+	"errors"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"void.io/x/cache/pb/cachepb"
+)
+
+func TestRegistry(t *testing.T) {
+	getter := func(prefix string) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			return []byte(prefix + key), nil
+		})
+	}
+	// 同名的 Group 可以分别存在于不同的 Registry 中
+	r1, r2 := NewRegistry(), NewRegistry()
+	r1.NewGroup("registry", 1024, getter("r1-"))
+	r2.NewGroup("registry", 1024, getter("r2-"))
+	if GetGroup("registry") != nil {
+		t.Fatal("groups should not leak into the default registry")
+	}
+
+	for _, c := range []struct {
+		r    *Registry
+		want string
+	}{{r1, "r1-k"}, {r2, "r2-k"}} {
+		srv := httptest.NewServer(NewHTTPPool("127.0.0.1", "0", WithRegistry(c.r)))
+		getter := &httpGetter{host: strings.TrimPrefix(srv.URL, "http://")}
+		resp := &cachepb.Response{}
+		err := getter.Get(&cachepb.Request{Group: "registry", Key: "k"}, resp)
+		srv.Close()
+		if err != nil || string(resp.Value) != c.want {
+			t.Fatalf("want %v, got %q, %v", c.want, resp.Value, err)
+		}
+	}
+
+	if err := r1.DeleteGroup("registry"); err != nil {
+		t.Fatal(err)
+	}
+	if r1.GetGroup("registry") != nil || r2.GetGroup("registry") == nil {
+		t.Fatal("DeleteGroup should only affect its own registry")
+	}
+}
+
+func TestCreateGroupConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	src := NewRegistry()
+	src.NewGroup("registry-concurrent", 1024, getter, WithSnapshotDir(dir)).Get("a")
+	if err := src.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 能拿到 Group 时，快照一定已经恢复
+		for {
+			if g := r.GetGroup("registry-concurrent"); g != nil {
+				if _, ok := g.mainCache.peek(cacheKey(0, "a")); !ok {
+					t.Error("group published before its snapshot was restored")
+				}
+				return
+			}
+			runtime.Gosched()
+		}
+	}()
+
+	var (
+		wg      sync.WaitGroup
+		created int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.CreateGroup("registry-concurrent", 1024, getter, WithSnapshotDir(dir))
+			if err == nil {
+				atomic.AddInt32(&created, 1)
+			} else if !errors.Is(err, ErrGroupExists) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	<-done
+	if created != 1 {
+		t.Fatalf("want exactly one group created, got %d", created)
+	}
+}
@@ -0,0 +1,165 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxArgs 一条命令最多的参数个数
+	maxArgs = 1 << 12
+	// maxBulkLen 一个参数的最大长度，参数只有 key 等短字符串，不需要支持大的值
+	maxBulkLen = 1 << 20
+	// maxCommandLen 一条命令所有参数的总长度上限
+	maxCommandLen = 16 << 20
+	// maxInlineLen inline 命令一行的最大长度
+	maxInlineLen = 64 << 10
+	// bulkChunk 小于该长度的参数一次分配，更长的参数随着数据的到达逐步扩大缓冲区
+	bulkChunk = 16 << 10
+)
+
+// protocolError 表示客户端发送的数据不符合 RESP 协议，回复错误后会关闭连接
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// readCommand 读取一条命令，支持 RESP 数组（*<n>\r\n$<len>\r\n<arg>\r\n...）
+// 和 inline 命令（以空格分隔的一行，例如 telnet 中输入的 "GET group:key"）
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		var args [][]byte
+		for _, f := range strings.Fields(string(line)) {
+			args = append(args, []byte(f))
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([][]byte, 0, n)
+	total := 0
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got %q", line))
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+		if total += size; total > maxCommandLen {
+			return nil, protocolError("command too large")
+		}
+		arg, err := readBulk(r, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk 读取长度为 size 的参数以及结尾的 \r\n。长度来自客户端，
+// 较长的参数不会按照长度一次分配内存，只发送长度不发送数据的客户端占用不了多少内存
+func readBulk(r *bufio.Reader, size int) ([]byte, error) {
+	var buf []byte
+	if size+2 <= bulkChunk {
+		buf = make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		var b bytes.Buffer
+		if _, err := io.CopyN(&b, r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		buf = b.Bytes()
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return nil, protocolError("bulk string not terminated by CRLF")
+	}
+	return buf[:size], nil
+}
+
+// readLine 读取以 \r\n（或者 \n）结尾的一行，不包括行尾
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		b, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b...)
+		if len(line) > maxInlineLen {
+			return nil, protocolError("too big inline request")
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// writer 以 RESP2 格式写回复
+type writer struct {
+	*bufio.Writer
+}
+
+func (w writer) simple(s string) {
+	w.WriteByte('+')
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// error 写错误回复，msg 的第一个单词为错误类型，例如 "ERR unknown command"
+func (w writer) error(msg string) {
+	w.WriteByte('-')
+	// 错误回复只能有一行
+	w.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+	w.WriteString("\r\n")
+}
+
+func (w writer) integer(n int64) {
+	w.WriteByte(':')
+	w.WriteString(strconv.FormatInt(n, 10))
+	w.WriteString("\r\n")
+}
+
+func (w writer) bulk(b []byte) {
+	w.WriteByte('$')
+	w.WriteString(strconv.Itoa(len(b)))
+	w.WriteString("\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+// null 写空回复，对应不存在的 key
+func (w writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+func (w writer) array(n int) {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(n))
+	w.WriteString("\r\n")
+}
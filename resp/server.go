@@ -0,0 +1,475 @@
+// Package resp 实现了 Redis RESP 协议的一个只读为主的子集，使得 redis-cli 和现有的 Redis 客户端库
+// 可以通过 groupcache 读取数据。key 的格式为 <groupName>:<key>，以第一个 ':' 分隔，
+// 支持的命令有：
+//
+//	GET group:key            Group.Get，key 不存在（ErrNotFound）时返回 nil
+//	MGET group:key ...       依次 Get 多个 key，可以属于不同的 Group
+//	DEL group:key ...        Group.Remove，只删除当前节点的缓存，返回处理的 key 的数量
+//	INFO [groupName]         Group.Stats，不指定 groupName 时返回所有 Group
+//	PING [message]、ECHO message、SELECT 0、QUIT
+//
+// 其他命令（包括所有写命令）都会返回错误
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"void.io/x/cache"
+)
+
+// ErrServerClosed 表示 Server 已经关闭
+var ErrServerClosed = errors.New("resp: server closed")
+
+const (
+	// DefaultIdleTimeout 默认的空闲超时，连接上超过该时间没有新的命令时会被关闭
+	DefaultIdleTimeout = 5 * time.Minute
+	// DefaultReadTimeout 默认的读超时，开始接收一条命令之后需要在该时间内接收完
+	DefaultReadTimeout = 30 * time.Second
+	// DefaultWriteTimeout 默认的写超时，每次发送回复的时间上限
+	DefaultWriteTimeout = 30 * time.Second
+)
+
+type Option func(s *Server)
+
+// WithRegistry 指定从哪个 Registry 中查找 Group，默认为 groupcache.DefaultRegistry
+func WithRegistry(r *groupcache.Registry) Option {
+	return func(s *Server) {
+		s.registry = r
+	}
+}
+
+// WithLogger 指定 Server 的日志，默认为 groupcache.DefaultLogger
+func WithLogger(l groupcache.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithIdleTimeout 指定空闲超时，默认为 DefaultIdleTimeout，0 表示不超时
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithReadTimeout 指定接收一条命令的超时时间，默认为 DefaultReadTimeout，0 表示不超时
+func WithReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout 指定发送回复的超时时间，默认为 DefaultWriteTimeout，0 表示不超时
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// Server 在 TCP 连接上提供 RESP 协议的服务
+type Server struct {
+	registry *groupcache.Registry
+	logger   groupcache.Logger
+
+	idleTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	ctx    context.Context // 传递给 Group.GetContext，Close 时取消
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup // 正在处理的连接
+}
+
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		idleTimeout:  DefaultIdleTimeout,
+		readTimeout:  DefaultReadTimeout,
+		writeTimeout: DefaultWriteTimeout,
+		listeners:    make(map[net.Listener]struct{}),
+		conns:        make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.registry == nil {
+		s.registry = groupcache.DefaultRegistry
+	}
+	if s.logger == nil {
+		s.logger = groupcache.DefaultLogger
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// ListenAndServe 监听 TCP 地址 addr 并调用 Serve
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 接受 l 上的连接，每个连接一个 goroutine，直到 l 出错或者 Server 被关闭，
+// Server 被关闭时返回 ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭所有的监听和连接，并等待正在处理的命令结束
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.cancel()
+	var first error
+	for l := range s.listeners {
+		if err := l.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return first
+}
+
+// track 记录新的连接，Server 已经关闭时返回 false
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := writer{bufio.NewWriter(timeoutWriter{conn, s.writeTimeout})}
+	for {
+		args, err := s.readCommand(conn, r)
+		if err != nil {
+			var (
+				pe protocolError
+				ne net.Error
+			)
+			switch {
+			case errors.As(err, &pe):
+				w.error("ERR " + pe.Error())
+				w.Flush()
+			case errors.As(err, &ne) && ne.Timeout():
+				s.logger.Debug("resp connection timed out", "peer", conn.RemoteAddr(), "err", err)
+			case err != io.EOF && !errors.Is(err, net.ErrClosed):
+				s.logger.Error("resp read failed", "peer", conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.exec(w, args)
+		// 客户端使用 pipeline 时，处理完缓冲区中所有的命令之后再一起发送回复
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// readCommand 读取下一条命令：等待命令开始时使用空闲超时，开始接收之后使用读超时，
+// 缓冲区中已经有 pipeline 的后续命令时直接读取
+func (s *Server) readCommand(conn net.Conn, r *bufio.Reader) ([][]byte, error) {
+	if r.Buffered() == 0 {
+		if err := conn.SetReadDeadline(deadline(s.idleTimeout)); err != nil {
+			return nil, err
+		}
+		if _, err := r.Peek(1); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.SetReadDeadline(deadline(s.readTimeout)); err != nil {
+		return nil, err
+	}
+	return readCommand(r)
+}
+
+// deadline 返回 timeout 之后的时间，timeout 为 0 时返回零值，表示不超时
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// timeoutWriter 在每次写入连接之前设置写超时，回复较大时 bufio.Writer 在执行命令的过程中就会写入
+type timeoutWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w timeoutWriter) Write(p []byte) (int, error) {
+	if err := w.conn.SetWriteDeadline(deadline(w.timeout)); err != nil {
+		return 0, err
+	}
+	return w.conn.Write(p)
+}
+
+// exec 执行一条命令并写入回复，返回是否需要关闭连接
+func (s *Server) exec(w writer, args [][]byte) (quit bool) {
+	name := strings.ToUpper(string(args[0]))
+	args = args[1:]
+	switch name {
+	case "GET":
+		if len(args) != 1 {
+			wrongArgs(w, name)
+			return
+		}
+		val, err := s.get(args[0])
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if val == nil {
+			w.null()
+			return
+		}
+		w.bulk(val)
+	case "MGET":
+		if len(args) == 0 {
+			wrongArgs(w, name)
+			return
+		}
+		// 先全部获取再写回复，其中一个 key 出错时整个命令返回错误
+		vals := make([][]byte, len(args))
+		for i, arg := range args {
+			val, err := s.get(arg)
+			if err != nil {
+				s.writeError(w, err)
+				return
+			}
+			vals[i] = val
+		}
+		w.array(len(vals))
+		for _, val := range vals {
+			if val == nil {
+				w.null()
+			} else {
+				w.bulk(val)
+			}
+		}
+	case "DEL":
+		if len(args) == 0 {
+			wrongArgs(w, name)
+			return
+		}
+		// 先检查所有的 key，有一个 Group 不存在时什么也不删除。
+		// Group.Remove 不会告知 key 是否存在，返回的是处理的 key 的数量
+		groups := make([]*groupcache.Group, len(args))
+		keys := make([]string, len(args))
+		for i, arg := range args {
+			group, key, err := s.lookup(arg)
+			if err != nil {
+				s.writeError(w, err)
+				return
+			}
+			groups[i], keys[i] = group, key
+		}
+		for i, group := range groups {
+			group.Remove(keys[i])
+		}
+		w.integer(int64(len(keys)))
+	case "INFO":
+		if len(args) > 1 {
+			wrongArgs(w, name)
+			return
+		}
+		names := s.registry.GroupNames()
+		if len(args) == 1 {
+			names = []string{string(args[0])}
+		}
+		w.bulk([]byte(s.info(names)))
+	case "PING":
+		switch len(args) {
+		case 0:
+			w.simple("PONG")
+		case 1:
+			w.bulk(args[0])
+		default:
+			wrongArgs(w, name)
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			wrongArgs(w, name)
+			return
+		}
+		w.bulk(args[0])
+	case "SELECT":
+		// 只有一个数据库
+		if len(args) != 1 || string(args[0]) != "0" {
+			w.error("ERR DB index is out of range")
+			return
+		}
+		w.simple("OK")
+	case "QUIT":
+		w.simple("OK")
+		return true
+	default:
+		w.error(fmt.Sprintf("ERR unknown command '%s'", truncate(name)))
+	}
+	return false
+}
+
+// get 获取 <groupName>:<key>，key 不存在时返回 nil
+func (s *Server) get(arg []byte) ([]byte, error) {
+	group, key, err := s.lookup(arg)
+	if err != nil {
+		return nil, err
+	}
+	val, err := group.GetContext(s.ctx, key)
+	if errors.Is(err, groupcache.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val.ByteSlice(), nil
+}
+
+// lookup 将 <groupName>:<key> 拆分并查找 Group
+func (s *Server) lookup(arg []byte) (*groupcache.Group, string, error) {
+	i := bytes.IndexByte(arg, ':')
+	if i < 0 {
+		return nil, "", fmt.Errorf("key must be in the form of <group>:<key>, got %q", arg)
+	}
+	groupName, key := string(arg[:i]), string(arg[i+1:])
+	group := s.registry.GetGroup(groupName)
+	if group == nil {
+		return nil, "", fmt.Errorf("%w: %v", groupcache.ErrGroupNotFound, groupName)
+	}
+	return group, key, nil
+}
+
+// info 返回 INFO 命令的内容，每个 Group 一节，格式与 Redis 的 INFO 相同
+func (s *Server) info(names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		group := s.registry.GetGroup(name)
+		if group == nil {
+			continue
+		}
+		st := group.Stats()
+		fmt.Fprintf(&b, "# Group %s\r\n", name)
+		for _, f := range []struct {
+			name  string
+			value int64
+		}{
+			{"gets", st.Gets},
+			{"hits", st.Hits},
+			{"peer_loads", st.PeerLoads},
+			{"peer_errors", st.PeerErrors},
+			{"loads", st.Loads},
+			{"load_errors", st.LoadErrors},
+			{"loads_waited", st.LoadsWaited},
+			{"loads_throttled", st.LoadsThrottled},
+			{"cache_bytes", st.CacheBytes},
+			{"cache_items", st.CacheItems},
+		} {
+			b.WriteString(f.name + ":" + strconv.FormatInt(f.value, 10) + "\r\n")
+		}
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// writeError 将 Group 返回的错误写为错误回复，错误类型与 groupcache 的错误对应
+func (s *Server) writeError(w writer, err error) {
+	prefix := "ERR"
+	switch {
+	case errors.Is(err, groupcache.ErrGroupNotFound):
+		prefix = "NOGROUP"
+	case errors.Is(err, groupcache.ErrLoadTimeout):
+		prefix = "TIMEOUT"
+	case errors.Is(err, groupcache.ErrLoadThrottled):
+		prefix = "BUSY"
+	case errors.Is(err, groupcache.ErrPeerUnavailable):
+		prefix = "UNAVAILABLE"
+	}
+	w.error(prefix + " " + err.Error())
+}
+
+func wrongArgs(w writer, name string) {
+	w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// truncate 截断过长的命令名，避免把整个请求写回错误回复
+func truncate(name string) string {
+	if len(name) > 64 {
+		return name[:64] + "..."
+	}
+	return name
+}
@@ -0,0 +1,252 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"void.io/x/cache"
+)
+
+// client 是一个最简单的 RESP 客户端，用于测试
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send 以 RESP 数组的格式发送一条命令，不等待回复
+func (c *client) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// do 发送命令并读取回复
+func (c *client) do(args ...string) any {
+	c.send(args...)
+	return c.read()
+}
+
+// read 读取一个回复：简单字符串为 string，错误为 error，整数为 int64，
+// bulk string 为 []byte（nil 表示空回复），数组为 []any
+func (c *client) read() any {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return errors.New(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return []byte(nil)
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			c.t.Fatal(err)
+		}
+		return b[:n]
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		arr := make([]any, n)
+		for i := range arr {
+			arr[i] = c.read()
+		}
+		return arr
+	}
+	c.t.Fatalf("bad reply %q", line)
+	return nil
+}
+
+func startServer(t *testing.T) (*groupcache.Registry, string) {
+	registry := groupcache.NewRegistry()
+	registry.NewGroup("users", 1024, groupcache.GetterFunc(func(key string) ([]byte, error) {
+		if strings.HasPrefix(key, "missing") {
+			return nil, groupcache.ErrNotFound
+		}
+		return []byte("user " + key), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(WithRegistry(registry))
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve should return ErrServerClosed, got %v", err)
+		}
+	})
+	return registry, l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	registry, addr := startServer(t)
+	c := dial(t, addr)
+
+	if got := c.do("PING"); got != "PONG" {
+		t.Fatalf("PING: got %v", got)
+	}
+	if got := c.do("get", "users:1:a b"); string(got.([]byte)) != "user 1:a b" {
+		t.Fatalf("GET: got %q", got)
+	}
+	if got := c.do("GET", "users:missing"); got.([]byte) != nil {
+		t.Fatalf("GET missing key: want nil, got %q", got)
+	}
+	if got, ok := c.do("GET", "nosuch:k").(error); !ok || !strings.HasPrefix(got.Error(), "NOGROUP") {
+		t.Fatalf("GET unknown group: got %v", got)
+	}
+	if _, ok := c.do("GET", "nocolon").(error); !ok {
+		t.Fatal("GET without group should fail")
+	}
+	if _, ok := c.do("GET").(error); !ok {
+		t.Fatal("GET without key should fail")
+	}
+
+	arr := c.do("MGET", "users:1", "users:missing", "users:2").([]any)
+	if len(arr) != 3 || string(arr[0].([]byte)) != "user 1" || arr[1].([]byte) != nil || string(arr[2].([]byte)) != "user 2" {
+		t.Fatalf("MGET: got %q", arr)
+	}
+
+	group := registry.GetGroup("users")
+	before := group.Stats().CacheItems
+	if got := c.do("DEL", "users:1", "users:2"); got != int64(2) {
+		t.Fatalf("DEL: got %v", got)
+	}
+	if after := group.Stats().CacheItems; after != before-2 {
+		t.Fatalf("DEL should remove the cache, items %d -> %d", before, after)
+	}
+
+	info := string(c.do("INFO").([]byte))
+	if !strings.Contains(info, "# Group users\r\n") || !strings.Contains(info, "gets:5\r\n") {
+		t.Fatalf("INFO: got %q", info)
+	}
+	if got := c.do("SET", "users:1", "x"); !strings.Contains(fmt.Sprint(got), "unknown command") {
+		t.Fatalf("SET should be rejected, got %v", got)
+	}
+	if got := c.do("QUIT"); got != "OK" {
+		t.Fatalf("QUIT: got %v", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("connection should be closed after QUIT")
+	}
+}
+
+func TestPipelineAndInline(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	// 一次发送多条命令，回复按顺序返回
+	c.send("GET", "users:a")
+	c.send("ECHO", "hello")
+	c.send("GET", "users:b")
+	for _, want := range []string{"user a", "hello", "user b"} {
+		if got := c.read(); string(got.([]byte)) != want {
+			t.Fatalf("pipeline: want %q, got %q", want, got)
+		}
+	}
+
+	// telnet 风格的 inline 命令
+	if _, err := c.conn.Write([]byte("GET users:c\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.read(); string(got.([]byte)) != "user c" {
+		t.Fatalf("inline GET: got %q", got)
+	}
+	if got := c.read(); got != "PONG" {
+		t.Fatalf("inline PING: got %v", got)
+	}
+
+	// 不符合协议的数据会得到错误回复并断开连接
+	if _, err := c.conn.Write([]byte("*1\r\n:1\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.read().(error); !ok || !strings.Contains(got.Error(), "Protocol error") {
+		t.Fatalf("want protocol error, got %v", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	_, addr := startServer(t)
+
+	// 参数长度超过上限时直接回复错误，不会等待数据
+	c := dial(t, addr)
+	if _, err := c.conn.Write([]byte(fmt.Sprintf("*1\r\n$%d\r\n", maxBulkLen+1))); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.read().(error); !ok || !strings.Contains(got.Error(), "invalid bulk length") {
+		t.Fatalf("want invalid bulk length, got %v", got)
+	}
+
+	// 较长的参数分多次到达
+	c = dial(t, addr)
+	arg := strings.Repeat("x", 3*bulkChunk)
+	if _, err := c.conn.Write([]byte(fmt.Sprintf("*2\r\n$4\r\nECHO\r\n$%d\r\n%s", len(arg), arg[:bulkChunk]))); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c.conn.Write([]byte(arg[bulkChunk:] + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.read(); string(got.([]byte)) != arg {
+		t.Fatalf("ECHO of a long argument: got %d bytes", len(got.([]byte)))
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	registry := groupcache.NewRegistry()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(WithRegistry(registry), WithIdleTimeout(50*time.Millisecond), WithReadTimeout(50*time.Millisecond))
+	go s.Serve(l)
+	defer s.Close()
+
+	// 空闲的连接和只发送了一半命令的连接都会被关闭
+	idle := dial(t, l.Addr().String())
+	half := dial(t, l.Addr().String())
+	if _, err := half.conn.Write([]byte("*2\r\n$3\r\nGET\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*client{idle, half} {
+		start := time.Now()
+		if _, err := c.r.ReadByte(); err != io.EOF {
+			t.Fatalf("want the connection closed by the server, got %v", err)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("connection should be closed after the timeout")
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"void.io/x/cache/pb/cachepb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxSetBytes 是远程节点 Set 请求体的默认大小上限
+const DefaultMaxSetBytes = 64 << 20
+
+// WithMaxSetBytes 指定远程节点 Set 请求体的大小上限，默认为 DefaultMaxSetBytes，超出时返回 400
+func WithMaxSetBytes(n int64) HTTPPoolOption {
+	return func(pool *HTTPPool) {
+		pool.maxSetBytes = n
+	}
+}
+
+// PeerSetter 是 PeerGetter 可以选择实现的接口，用于将值写入远程节点
+type PeerSetter interface {
+	Set(in *cachepb.SetRequest, out *cachepb.SetResponse) error
+}
+
+// Set 将 key 的值设置为 value（写穿）：value 会被发送到负责该 key 的节点并写入其缓存，
+// 之后的 Get 不需要再调用 Getter。负责该 key 的不是当前节点时，当前节点上该 key 的副本会被删除。
+// 过期时间和压缩由负责该 key 的节点的配置决定
+func (g *Group) Set(ctx context.Context, key string, value []byte) error {
+	_, err := g.set(ctx, key, value, false, 0)
+	return err
+}
+
+// set 实现 Set 和 CompareAndSet，compare 为 true 时只有当前版本号等于 expected 才会写入，返回新的版本号
+func (g *Group) set(ctx context.Context, key string, value []byte, compare bool, expected uint64) (version uint64, err error) {
+	if key == "" {
+		return 0, fmt.Errorf("key is required")
+	}
+	if !g.enter() {
+		return 0, ErrGroupClosed
+	}
+	defer g.inflight.Done()
+
+	ctx, span := g.tracer.Start(ctx, "groupcache.Set", "group", g.name, "key", key)
+	defer func() { span.End(err) }()
+
+	gen := g.Generation()
+	if g.peers != nil {
+		if addr, peer, notSelf := g.peers.PickPeer(key); notSelf {
+			span.SetAttributes("peer", addr)
+			setter, ok := peer.(PeerSetter)
+			if !ok {
+				return 0, fmt.Errorf("groupcache: peer %v does not support Set", addr)
+			}
+			req := &cachepb.SetRequest{
+				Group:           g.name,
+				Key:             key,
+				Value:           value,
+				TraceParent:     g.tracer.Inject(ctx),
+				Generation:      gen,
+				Compare:         compare,
+				ExpectedVersion: expected,
+			}
+			resp := &cachepb.SetResponse{}
+			if err := setter.Set(req, resp); err != nil {
+				return 0, err
+			}
+			g.observeGeneration(resp.Generation)
+			if resp.Conflict {
+				return 0, &VersionConflictError{Key: key, Expected: expected, Current: resp.Version}
+			}
+			g.logger.Debug("set on peer", "node", g.addr(), "group", g.name, "key", key, "peer", addr)
+			g.removeLocally(cacheKey(gen, key), EvictRemoved)
+			return resp.Version, nil
+		}
+	}
+	return g.setLocally(ctx, key, value, compare, expected)
+}
+
+// casAttempts 是 CompareAndSet 在锁外加载当前值的次数，加载的值每次都在拿到锁之前被淘汰时，
+// 最后一次在锁内加载
+const casAttempts = 3
+
+// setLocally 将 value 写入当前节点的缓存，替换掉已有的值（包括磁盘缓存中的），返回新的版本号，
+// compare 的含义与 set 相同。需要知道当前的版本号时，在 writeMu 之外加载，
+// 避免所有的写入都等待数据源，持有锁时只比较和写入
+func (g *Group) setLocally(ctx context.Context, key string, value []byte, compare bool, expected uint64) (uint64, error) {
+	for attempt := 1; ; attempt++ {
+		locked := attempt >= casAttempts
+		if compare && !locked {
+			if _, err := g.get(ctx, key); err != nil {
+				return 0, err
+			}
+		}
+		g.writeMu.Lock()
+		version, done, err := g.setLocked(ctx, key, value, compare, expected, locked)
+		g.writeMu.Unlock()
+		if done {
+			return version, err
+		}
+	}
+}
+
+// setLocked 在持有 writeMu 时写入，compare 为 true 且当前值不在缓存中时，load 为 true 则加载，
+// 否则返回 done 为 false，由调用者在锁外加载后重试
+func (g *Group) setLocked(ctx context.Context, key string, value []byte, compare bool, expected uint64, load bool) (version uint64, done bool, err error) {
+	ck := cacheKey(g.Generation(), key)
+	var cur uint64
+	if val, ok := g.mainCache.peek(ck); ok {
+		cur = val.version
+	} else if compare {
+		if !load {
+			return 0, false, nil
+		}
+		val, err := g.get(ctx, key)
+		if err != nil {
+			return 0, true, err
+		}
+		cur = val.version
+	}
+	if compare && cur != expected {
+		return 0, true, &VersionConflictError{Key: key, Expected: expected, Current: cur}
+	}
+
+	val := &ByteView{b: cloneBytes(value), version: g.nextVersion(cur + 1)}
+	if g.ttl > 0 {
+		val.e = time.Now().Add(g.ttl)
+	}
+	if g.diskTier != nil {
+		if err := g.diskTier.Delete(ck); err != nil {
+			g.logger.Error("delete from disk failed", "group", g.name, "key", key, "err", err)
+		}
+	}
+	// 先增加失效纪元，写入（包括 CompareAndSet）之前开始的加载不会再用旧的数据覆盖写入的值，
+	// 否则加载的结果会得到更新的版本号，CompareAndSet 写入的值就悄悄丢失了
+	g.bumpEpoch(key)
+	g.addCache(ck, g.compress(val))
+	g.logger.Debug("set locally", "node", g.addr(), "group", g.name, "key", key, "version", val.version)
+	return val.version, true, nil
+}
+
+// serveSet 处理 PUT <baseURL>/<groupName> 请求，请求体为 proto 编码的 SetRequest，
+// 也兼容 PUT <baseURL>/<groupName>/<key>，请求体中的 key 为空时使用路径中的 key
+func (h *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	body, err := readBody(w, r, h.maxSetBytes)
+	if err != nil {
+		writeErrorCode(w, codeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	in := &cachepb.SetRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		writeErrorCode(w, codeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(in.KeyBytes) > 0 {
+		key = string(in.KeyBytes)
+	} else if in.Key != "" {
+		key = in.Key
+	}
+	if h.trustGeneration(r) {
+		group.observeGeneration(in.Generation)
+	}
+
+	ctx := group.tracer.Extract(r.Context(), r.Header.Get(traceHeader))
+	ctx, span := group.tracer.Start(ctx, "groupcache.serveSet", "group", group.name, "key", key)
+	// 请求方认为当前节点负责该 key，即使当前节点的哈希环与请求方不一致也直接写入，避免转发循环
+	version, err := group.setLocally(ctx, key, in.Value, in.Compare, in.ExpectedVersion)
+	span.End(err)
+	out := &cachepb.SetResponse{Generation: group.Generation(), Version: version}
+	var conflict *VersionConflictError
+	if errors.As(err, &conflict) {
+		out.Conflict, out.Version = true, conflict.Current
+	} else if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp, err := proto.Marshal(out)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(resp)
+}
+
+func (h *httpGetter) Set(in *cachepb.SetRequest, out *cachepb.SetResponse) error {
+	if h.breaker != nil && !h.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	peerFailed, err := h.set(in, out)
+	if h.breaker != nil {
+		if peerFailed {
+			h.breaker.onFailure()
+		} else {
+			h.breaker.onSuccess()
+		}
+	}
+	return err
+}
+
+// set 发起实际的 http 请求，peerFailed 的含义与 get 相同
+func (h *httpGetter) set(in *cachepb.SetRequest, out *cachepb.SetResponse) (peerFailed bool, err error) {
+	msg := in
+	if !utf8.ValidString(in.Key) {
+		// 见 cachepb.Request.KeyBytes
+		msg = proto.Clone(in).(*cachepb.SetRequest)
+		msg.Key, msg.KeyBytes = "", []byte(in.Key)
+	}
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return false, err
+	}
+	// key 在请求体中，不放在 URL 里
+	req, err := http.NewRequest(http.MethodPut, h.url(nil, in.Group), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if in.TraceParent != "" {
+		req.Header.Set(traceHeader, in.TraceParent)
+	}
+	_, b, peerFailed, err := h.do(req)
+	if err != nil {
+		return peerFailed, err
+	}
+	return false, proto.Unmarshal(b, out)
+}
+
+var _ PeerSetter = (*httpGetter)(nil)
@@ -0,0 +1,101 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("should be served from the value set")
+	})
+	a, poolA, addrA := startNode(t, "set", getter)
+	b, poolB, addrB := startNode(t, "set", getter)
+	poolA.Set(addrA, addrB)
+	poolB.Set(addrA, addrB)
+
+	// 找一个由 b 负责的 key
+	key := "k"
+	for i := 0; poolA.peers.Get(key) != addrB; i++ {
+		key = "k" + string(rune('a'+i))
+	}
+	// a 上的旧副本会在写入 b 之后被删除
+	a.setLocally(context.Background(), key, []byte("old"), false, 0)
+
+	ctx := context.Background()
+	if err := a.Set(ctx, key, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.mainCache.get(cacheKey(0, key)); ok {
+		t.Fatal("local copy on a non-owner should be dropped")
+	}
+	if val, ok := b.mainCache.get(cacheKey(0, key)); !ok || val.String() != "v1" {
+		t.Fatalf("owner should store the value, got %v", val)
+	}
+	for _, g := range []*Group{a, b} {
+		if val, err := g.Get(key); err != nil || val.String() != "v1" {
+			t.Fatalf("get from %v: %v, %v", g.addr(), val, err)
+		}
+	}
+
+	// 负责该 key 的是当前节点时直接写入本地
+	if err := b.Set(ctx, key, []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := a.Get(key); err != nil || val.String() != "v2" {
+		t.Fatalf("want v2, got %v, %v", val, err)
+	}
+}
+
+func TestSetTooLarge(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	a, poolA, addrA := startNode(t, "set-large", getter)
+	_, poolB, addrB := startNode(t, "set-large", getter)
+	poolA.Set(addrA, addrB)
+	poolB.Set(addrA, addrB)
+	WithMaxSetBytes(64)(poolB)
+
+	key := "k"
+	for i := 0; poolA.peers.Get(key) != addrB; i++ {
+		key = "k" + string(rune('a'+i))
+	}
+	err := a.Set(context.Background(), key, make([]byte, 128))
+	var pe *PeerError
+	if !errors.As(err, &pe) || pe.Code != codeBadRequest {
+		t.Fatalf("want bad request for an oversized value, got %v", err)
+	}
+}
+
+func TestSetDuringLoad(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	group := NewRegistry().NewGroup("set-inflight", 1024, GetterFunc(func(key string) ([]byte, error) {
+		once.Do(func() {
+			close(loading)
+			<-release
+		})
+		return []byte("old"), nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := group.Get("k")
+		done <- err
+	}()
+	<-loading
+	// 写入之前开始的加载读到的是旧的数据，完成后不能覆盖写入的值
+	if err := group.Set(context.Background(), "k", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if val, err := group.Get("k"); err != nil || val.String() != "new" {
+		t.Fatalf("want the value set, got %v, %v", val, err)
+	}
+}
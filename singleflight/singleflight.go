@@ -1,6 +1,12 @@
 package singleflight
 
-import "sync"
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPanicked 是 fn panic 时其他等待该调用的 goroutine 得到的错误，panic 本身会传递给调用 fn 的 goroutine
+var ErrPanicked = errors.New("singleflight: fn panicked")
 
 type call struct {
 	value any
@@ -32,12 +38,15 @@ func (g *Group) Do(key string, fn func() (any, error)) (any, error) {
 	g.m[key] = c
 	g.Unlock()
 
+	c.err = ErrPanicked
+	defer func() {
+		// 即使 fn panic 也要唤醒等待者并删除 key，否则之后该 key 的调用会一直阻塞
+		c.wg.Done()
+		g.Lock()
+		delete(g.m, key)
+		g.Unlock()
+	}()
 	c.value, c.err = fn()
-	c.wg.Done()
-
-	g.Lock()
-	delete(g.m, key)
-	g.Unlock()
 
 	return c.value, c.err
 }
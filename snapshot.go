@@ -0,0 +1,282 @@
+package groupcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"void.io/x/cache/lru"
+)
+
+// 快照的二进制格式（整数均为大端序或 varint）：
+//
+//	magic    [4]byte  "GCSN"
+//	version  uint8
+//	gen      uvarint  保存快照时的 generation（version 3 新增）
+//	count    uvarint  缓存条目数
+//	entries  按照从最久未使用到最近使用的顺序排列，恢复时依次添加即可还原 LRU 顺序
+//	  keyLen uvarint, key
+//	  valLen uvarint, value
+//	  expire varint   过期时间，unix 纳秒时间戳，0 表示永不过期
+//	  codecLen uvarint, codec  压缩算法，为空表示没有压缩（version 2 新增）
+//	  ver    uvarint  值的版本号（version 4 新增）
+//	checksum uint32   之前所有字节的 CRC32（IEEE）
+const (
+	snapshotMagic   = "GCSN"
+	snapshotVersion = 4
+)
+
+// ErrBadSnapshot 表示快照格式错误或者校验失败
+var ErrBadSnapshot = errors.New("groupcache: bad snapshot")
+
+// WithSnapshotDir 指定快照目录：NewGroup 时会从该目录恢复缓存，
+// 调用 Shutdown 时会把缓存保存到该目录，文件名为 <group name>.snapshot
+func WithSnapshotDir(dir string) GroupOption {
+	return func(g *Group) {
+		g.snapshotDir = dir
+	}
+}
+
+// snapshot 将缓存写入 w，gen 为当前的 generation。
+// 持有锁时只复制条目的引用（ByteView 不可变），写入 w 在释放锁之后进行，慢的 w 不会阻塞缓存的读写
+func (c *cache) snapshot(w io.Writer, gen uint64) error {
+	type entry struct {
+		key string
+		val *ByteView
+	}
+	c.mu.RLock()
+	var entries []entry
+	if c.lru != nil {
+		entries = make([]entry, 0, c.lru.Len())
+		c.lru.Range(func(key string, value lru.Value) bool {
+			entries = append(entries, entry{key, value.(*ByteView)})
+			return true
+		})
+	}
+	c.mu.RUnlock()
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+	bw.Write(buf[:binary.PutUvarint(buf, gen)])
+	bw.Write(buf[:binary.PutUvarint(buf, uint64(len(entries)))])
+	for _, e := range entries {
+		val := e.val
+		bw.Write(buf[:binary.PutUvarint(buf, uint64(len(e.key)))])
+		bw.WriteString(e.key)
+		bw.Write(buf[:binary.PutUvarint(buf, uint64(len(val.b)))])
+		bw.Write(val.b)
+		var expire int64
+		if !val.e.IsZero() {
+			expire = val.e.UnixNano()
+		}
+		bw.Write(buf[:binary.PutVarint(buf, expire)])
+		bw.Write(buf[:binary.PutUvarint(buf, uint64(len(val.codec)))])
+		bw.WriteString(val.codec)
+		bw.Write(buf[:binary.PutUvarint(buf, val.version)])
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+// restore 从 r 中读取快照并添加到缓存，keep 返回 false 的条目（比如已经过期的）会被丢弃，
+// gen 为快照中保存的 generation（version 3 之前的快照为 0），在所有条目校验通过之后、调用 keep 之前传给 setGen。
+// 快照校验通过后才会修改缓存，返回恢复的条目数
+func (c *cache) restore(r io.Reader, setGen func(gen uint64), keep func(key string, val *ByteView) bool) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < len(snapshotMagic)+1+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, ErrBadSnapshot
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return 0, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+	version := body[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, version)
+	}
+
+	br := bytes.NewReader(body[len(snapshotMagic)+1:])
+	var gen uint64
+	if version >= 3 {
+		if gen, err = binary.ReadUvarint(br); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+		}
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(br.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+
+	type kv struct {
+		key string
+		val *ByteView
+	}
+	// count 来自输入，不能用来预先分配内存，每个条目至少占 4 个字节，超出剩余长度时一定是损坏的
+	if count > uint64(br.Len())/4 {
+		return 0, fmt.Errorf("%w: too many entries: %d", ErrBadSnapshot, count)
+	}
+	var entries []kv
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+		}
+		value, err := readBytes()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+		}
+		expire, err := binary.ReadVarint(br)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+		}
+		val := &ByteView{b: value}
+		if version >= 2 {
+			codec, err := readBytes()
+			if err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+			}
+			val.codec = string(codec)
+		}
+		if version >= 4 {
+			if val.version, err = binary.ReadUvarint(br); err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+			}
+		}
+		if expire != 0 {
+			val.e = time.Unix(0, expire)
+		}
+		entries = append(entries, kv{string(key), val})
+	}
+
+	if setGen != nil {
+		setGen(gen)
+	}
+	restored := 0
+	for _, e := range entries {
+		if keep != nil && !keep(e.key, e.val) {
+			continue
+		}
+		c.Add(e.key, e.val)
+		restored++
+	}
+	return restored, nil
+}
+
+// Snapshot 将 Group 的缓存（包括过期时间和 LRU 顺序）写入 w
+func (g *Group) Snapshot(w io.Writer) error {
+	return g.mainCache.snapshot(w, g.Generation())
+}
+
+// Restore 从 w 中恢复由 Snapshot 写入的缓存，generation 会增大到快照中保存的值，
+// 不属于当前 generation 的条目（已经无法访问），以及已经过期（且超出 stale window 和 grace period）的条目会被丢弃
+func (g *Group) Restore(r io.Reader) error {
+	now := time.Now()
+	var prefix string
+	setGen := func(gen uint64) {
+		g.raiseGeneration(gen)
+		prefix = cacheKey(g.Generation(), "")
+	}
+	n, err := g.mainCache.restore(r, setGen, func(key string, val *ByteView) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		val.version = g.restoredVersion(val.version)
+		keep := g.staleWindow
+		if g.gracePeriod > keep {
+			keep = g.gracePeriod
+		}
+		return !val.expired(now) || (keep > 0 && now.Before(val.e.Add(keep)))
+	})
+	if err != nil {
+		return err
+	}
+	g.logger.Info("snapshot restored", "node", g.addr(), "group", g.name, "entries", n)
+	return nil
+}
+
+// snapshotPath 返回该 Group 的快照文件路径
+func (g *Group) snapshotPath() string {
+	return filepath.Join(g.snapshotDir, url.PathEscape(g.name)+".snapshot")
+}
+
+// SaveSnapshot 将缓存保存到 WithSnapshotDir 指定的目录，没有指定目录时什么也不做，
+// 快照先写入临时文件再重命名，保证不会留下写了一半的快照
+func (g *Group) SaveSnapshot() error {
+	if g.snapshotDir == "" {
+		return nil
+	}
+	return writeFileAtomic(g.snapshotPath(), g.Snapshot)
+}
+
+// writeFileAtomic 通过 write 写入同一目录下的临时文件，写入成功后再重命名为 path，
+// 失败时 path 保持原来的内容
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadSnapshot 从 WithSnapshotDir 指定的目录恢复缓存，快照不存在时什么也不做
+func (g *Group) loadSnapshot() error {
+	f, err := os.Open(g.snapshotPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.Restore(f)
+}
@@ -0,0 +1,151 @@
+package groupcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"void.io/x/cache/lru"
+)
+
+func cacheKeys(c *cache) []string {
+	var keys []string
+	c.lru.Range(func(key string, value lru.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-" + key), nil
+	})
+	src := NewGroup("snapshot-src", 1024, getter, WithExpiration(time.Hour))
+	for _, key := range []string{"a", "b", "c"} {
+		src.Get(key)
+	}
+	src.Get("a")
+	// 已经过期的条目不会被恢复
+	src.mainCache.Add("expired", &ByteView{b: []byte("x"), e: time.Now().Add(-time.Second)})
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	dst := NewGroup("snapshot-dst", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("should be served from the restored cache")
+	}))
+	if err := dst.Restore(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(cacheKeys(dst.mainCache)); got != "[0/b 0/c 0/a]" {
+		t.Fatalf("LRU order should be kept, got %v", got)
+	}
+	val, err := dst.Get("b")
+	if err != nil || val.String() != "value-b" {
+		t.Fatalf("get restored value: %v, %v", val, err)
+	}
+	srcVal, _ := src.mainCache.get(cacheKey(0, "b"))
+	if !val.Expire().Equal(srcVal.Expire()) {
+		t.Fatalf("expire should be kept, got %v, want %v", val.Expire(), srcVal.Expire())
+	}
+
+	// 任意一个字节损坏都会导致校验失败，且不会修改缓存
+	corrupted := append([]byte(nil), data...)
+	corrupted[10] ^= 0xff
+	other := NewGroup("snapshot-corrupted", 1024, getter)
+	if err := other.Restore(bytes.NewReader(corrupted)); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("want ErrBadSnapshot, got %v", err)
+	}
+	if other.mainCache.lru != nil && other.mainCache.lru.Len() != 0 {
+		t.Fatal("corrupted snapshot should not be applied")
+	}
+}
+
+func TestSnapshotBadCount(t *testing.T) {
+	// 校验和正确，但条目数远大于实际数据
+	buf := make([]byte, binary.MaxVarintLen64)
+	body := append([]byte(snapshotMagic), snapshotVersion, 0)
+	body = append(body, buf[:binary.PutUvarint(buf, 1<<62)]...)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(body))
+	data := append(body, sum[:]...)
+
+	g := NewRegistry().NewGroup("snapshot-bad-count", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	if err := g.Restore(bytes.NewReader(data)); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("want ErrBadSnapshot, got %v", err)
+	}
+}
+
+// blockingWriter 在第一次 Write 时通知 started，然后一直等到 release 被关闭
+type blockingWriter struct {
+	started, release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.started:
+	default:
+		close(w.started)
+	}
+	<-w.release
+	return len(p), nil
+}
+
+func TestSnapshotSlowWriter(t *testing.T) {
+	c := &cache{size: 1024}
+	c.Add("a", &ByteView{b: []byte("a")})
+	w := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() { done <- c.snapshot(w, 0) }()
+	<-w.started
+
+	// 快照写入 w 期间缓存仍然可以读写
+	added := make(chan struct{})
+	go func() {
+		c.Add("b", &ByteView{b: []byte("b")})
+		c.get("a")
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("cache should not be locked while writing the snapshot")
+	}
+	close(w.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotDir(t *testing.T) {
+	dir := t.TempDir()
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	})
+	g := NewGroup("snapshot-dir", 1024, getter, WithSnapshotDir(dir))
+	g.Get("a")
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟重启：同名的 Group 会从快照目录恢复缓存
+	if err := DeleteGroup("snapshot-dir"); err != nil {
+		t.Fatal(err)
+	}
+	g = NewGroup("snapshot-dir", 1024, getter, WithSnapshotDir(dir))
+	if val, err := g.Get("a"); err != nil || val.String() != "a" || loads != 1 {
+		t.Fatalf("want value restored from snapshot, got %v, %v, loads %d", val, err, loads)
+	}
+}
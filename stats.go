@@ -0,0 +1,45 @@
+package groupcache
+
+import "sync/atomic"
+
+// GroupStats 是 Group 的统计信息，除了 CacheBytes 和 CacheItems 以外都是自创建以来的累计值
+type GroupStats struct {
+	Gets           int64 // Get 的次数
+	Hits           int64 // 命中缓存的次数（包括 stale window 内的旧值）
+	PeerLoads      int64 // 从远程节点获取的次数
+	PeerErrors     int64 // 从远程节点获取失败的次数
+	Loads          int64 // 调用 Getter 的次数
+	LoadErrors     int64 // 调用 Getter 失败的次数
+	LoadsWaited    int64 // 因为超出速率或并发限制而等待的加载次数
+	LoadsThrottled int64 // 因为超出速率或并发限制而失败的加载次数（ErrLoadThrottled）
+	CacheBytes     int64 // 当前缓存占用的字节数
+	CacheItems     int64 // 当前缓存的条目数
+}
+
+// groupStats 是 Group 内部的计数器，全部为原子操作
+type groupStats struct {
+	gets           int64
+	hits           int64
+	peerLoads      int64
+	peerErrors     int64
+	loads          int64
+	loadErrors     int64
+	loadsWaited    int64
+	loadsThrottled int64
+}
+
+// Stats 返回 Group 的统计信息
+func (g *Group) Stats() GroupStats {
+	return GroupStats{
+		Gets:           atomic.LoadInt64(&g.stats.gets),
+		Hits:           atomic.LoadInt64(&g.stats.hits),
+		PeerLoads:      atomic.LoadInt64(&g.stats.peerLoads),
+		PeerErrors:     atomic.LoadInt64(&g.stats.peerErrors),
+		Loads:          atomic.LoadInt64(&g.stats.loads),
+		LoadErrors:     atomic.LoadInt64(&g.stats.loadErrors),
+		LoadsWaited:    atomic.LoadInt64(&g.stats.loadsWaited),
+		LoadsThrottled: atomic.LoadInt64(&g.stats.loadsThrottled),
+		CacheBytes:     g.mainCache.bytes(),
+		CacheItems:     g.mainCache.items(),
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"void.io/x/cache"
+	"void.io/x/cache/discovery"
+	"void.io/x/cache/gossip"
 )
 
 func init() {
@@ -14,8 +20,12 @@ func init() {
 }
 
 var (
-	port = flag.String("p", "", "port")
-	db   = map[string]string{
+	port      = flag.String("p", "", "port")
+	peersFile = flag.String("f", "", "peers file, one address per line or a JSON array")
+	gossipAt  = flag.String("g", "", "gossip listen address, e.g. 127.0.0.1:7946")
+	seed      = flag.String("s", "", "gossip seed address to join")
+	snapDir   = flag.String("d", "", "snapshot directory, restore on start and save on exit")
+	db        = map[string]string{
 		"Tom":  "630",
 		"Jack": "589",
 		"Sam":  "567",
@@ -30,18 +40,54 @@ var (
 )
 
 func newGroup(name string, size int64, fn groupcache.Getter) *groupcache.Group {
-	return groupcache.NewGroup(name, size, fn)
+	var opts []groupcache.GroupOption
+	if *snapDir != "" {
+		opts = append(opts, groupcache.WithSnapshotDir(*snapDir))
+	}
+	return groupcache.NewGroup(name, size, fn, opts...)
 }
 
 // 一个缓存服务器
 func startCacheServer(host, port string, peersAddr []string, g *groupcache.Group) error {
 	pool := groupcache.NewHTTPPool(host, port)
-	pool.Set(peersAddr...)
+	if *gossipAt != "" {
+		// 通过 gossip 自动发现节点，新节点只需要知道任意一个已有节点的 gossip 地址
+		members, err := gossip.New(*gossipAt, gossip.WithMeta(pool.Addr()))
+		if err != nil {
+			return err
+		}
+		if *seed != "" {
+			if _, err := members.Join(*seed); err != nil {
+				return err
+			}
+		}
+		go func() {
+			err := pool.Watch(context.Background(), members)
+			log.Printf("watch gossip members error: %v", err)
+		}()
+	} else if *peersFile != "" {
+		// 从文件中发现节点，修改文件即可增减节点，无需重启
+		go func() {
+			err := pool.Watch(context.Background(), discovery.NewFile(*peersFile))
+			log.Printf("watch peers file error: %v", err)
+		}()
+	} else {
+		pool.Set(peersAddr...)
+	}
 	g.RegisterPeers(pool)
-	if err := http.ListenAndServe(fmt.Sprintf("%v:%v", host, port), pool); err != nil {
+
+	// 收到退出信号后优雅退出，并保存缓存快照
+	server := &http.Server{Addr: fmt.Sprintf("%v:%v", host, port), Handler: pool}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return err
 	}
-	return nil
+	return groupcache.Shutdown()
 }
 
 func main() {
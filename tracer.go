@@ -0,0 +1,56 @@
+package groupcache
+
+import "context"
+
+// traceHeader 是节点之间传递追踪上下文的 http 头，对应 cachepb.Request 的 trace_parent 字段
+const traceHeader = "Traceparent"
+
+// Tracer 用于在 Get 的各个阶段创建 span，可以用来对接 OpenTelemetry 等追踪系统。
+// 会创建的 span 有：
+//
+//	groupcache.Get            一次 Get 调用，属性 group、key、hit
+//	groupcache.singleflight   等待 singleflight 的结果，属性 group、key
+//	groupcache.getFromPeer    从远程节点获取，属性 group、key、peer
+//	groupcache.getFromLocally 调用 Getter 从数据源获取，属性 group、key
+//	groupcache.Set            一次 Set 或 CompareAndSet 调用，属性 group、key、peer
+//	groupcache.serveSet       负责该 key 的节点处理远程节点的 Set，属性 group、key
+//
+// 属性与 Logger 一样使用交替出现的 key、value 表示
+type Tracer interface {
+	// Start 以 ctx 中的 span（如果有）为父 span 创建一个新的 span，返回包含新 span 的 ctx
+	Start(ctx context.Context, name string, attrs ...any) (context.Context, Span)
+	// Inject 将 ctx 中的追踪上下文编码为字符串，随请求发送给远程节点
+	Inject(ctx context.Context) string
+	// Extract 解码远程节点发来的追踪上下文，返回的 ctx 中创建的 span 会成为远程 span 的子 span
+	Extract(ctx context.Context, traceParent string) context.Context
+}
+
+// Span 表示一段被追踪的操作
+type Span interface {
+	SetAttributes(attrs ...any)
+	// End 结束 span，err 为该操作返回的错误
+	End(err error)
+}
+
+// WithTracer 指定 Group 的 Tracer，默认不做任何追踪
+func WithTracer(t Tracer) GroupOption {
+	return func(g *Group) {
+		g.tracer = t
+	}
+}
+
+// noopTracer 是默认的 Tracer，什么也不做
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Inject(ctx context.Context) string { return "" }
+
+func (noopTracer) Extract(ctx context.Context, traceParent string) context.Context { return ctx }
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...any) {}
+func (noopSpan) End(err error)              {}
@@ -0,0 +1,144 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryTracer 将所有 span 记录在内存中，用于测试
+type memoryTracer struct {
+	mu    sync.Mutex
+	spans []*memorySpan
+}
+
+type memorySpan struct {
+	tracer *memoryTracer
+	id     string
+	parent string
+	name   string
+	attrs  map[string]any
+	ended  bool
+	err    error
+}
+
+type spanKey struct{}
+
+func (t *memoryTracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &memorySpan{tracer: t, id: strconv.Itoa(len(t.spans) + 1), name: name, attrs: make(map[string]any)}
+	if parent, ok := ctx.Value(spanKey{}).(string); ok {
+		s.parent = parent
+	}
+	s.setAttributes(attrs)
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s.id), s
+}
+
+func (t *memoryTracer) Inject(ctx context.Context) string {
+	id, _ := ctx.Value(spanKey{}).(string)
+	return id
+}
+
+func (t *memoryTracer) Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, traceParent)
+}
+
+func (t *memoryTracer) find(name string) []*memorySpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans []*memorySpan
+	for _, s := range t.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func (s *memorySpan) SetAttributes(attrs ...any) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.setAttributes(attrs)
+}
+
+func (s *memorySpan) setAttributes(attrs []any) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[attrs[i].(string)] = attrs[i+1]
+	}
+}
+
+func (s *memorySpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.ended, s.err = true, err
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &memoryTracer{}
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+
+	// 远程节点，负责所有的 key
+	remote := NewRegistry()
+	remote.NewGroup("trace", 1024, getter, WithTracer(tracer))
+	srv := httptest.NewServer(NewHTTPPool("127.0.0.1", "0", WithRegistry(remote)))
+	defer srv.Close()
+
+	local := NewRegistry()
+	group := local.NewGroup("trace", 1024, getter, WithTracer(tracer))
+	pool := NewHTTPPool("127.0.0.1", "0", WithRegistry(local))
+	pool.Set(strings.TrimPrefix(srv.URL, "http://"))
+	group.RegisterPeers(pool)
+
+	if _, err := group.GetContext(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := group.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	gets := tracer.find("groupcache.Get")
+	peers := tracer.find("groupcache.getFromPeer")
+	flights := tracer.find("groupcache.singleflight")
+	locals := tracer.find("groupcache.getFromLocally")
+	if len(gets) != 4 || len(peers) != 2 || len(flights) != 3 || len(locals) != 1 {
+		t.Fatalf("unexpected spans: %d Get, %d getFromPeer, %d singleflight, %d getFromLocally",
+			len(gets), len(peers), len(flights), len(locals))
+	}
+	for _, s := range tracer.spans {
+		if !s.ended || s.err != nil {
+			t.Fatalf("span %v should end without error", s.name)
+		}
+	}
+
+	// 本地 Get -> singleflight -> getFromPeer -> 远程 Get -> singleflight -> getFromLocally
+	localGet, remoteGet := gets[0], gets[1]
+	if localGet.parent != "" || localGet.attrs["hit"] != false {
+		t.Fatalf("local Get should be a root span and miss, got %+v", localGet)
+	}
+	if flights[0].parent != localGet.id || peers[0].parent != flights[0].id {
+		t.Fatal("getFromPeer should be a child of the local singleflight span")
+	}
+	if peers[0].attrs["peer"] != pool.peers.Get("a") {
+		t.Fatalf("getFromPeer should record the peer, got %v", peers[0].attrs["peer"])
+	}
+	if remoteGet.parent != peers[0].id {
+		t.Fatal("remote Get should link to the getFromPeer span through the request")
+	}
+	if locals[0].parent != flights[1].id || flights[1].parent != remoteGet.id {
+		t.Fatal("getFromLocally should be a child of the remote singleflight span")
+	}
+	// 当前节点不缓存远程节点的数据，第二次 Get 仍然会请求远程节点，远程节点命中缓存
+	if gets[2].attrs["hit"] != false || gets[3].attrs["hit"] != true || gets[3].parent != peers[1].id {
+		t.Fatal("second Get should hit the cache of the remote peer")
+	}
+}
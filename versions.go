@@ -0,0 +1,101 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// 缓存中的每个值都有一个版本号：
+//   - Getter 实现了 VersionedGetter 时，使用数据源提供的版本号
+//   - 否则由负责该 key 的节点分配，同一个 Group 内单调递增
+//
+// Set 和 CompareAndSet 写入的值总是会得到一个比之前更大的版本号
+
+// ErrVersionConflict 表示 CompareAndSet 时版本号不匹配，具体的错误为 *VersionConflictError
+var ErrVersionConflict = errors.New("groupcache: version conflict")
+
+// VersionConflictError 是 CompareAndSet 时版本号不匹配的错误，errors.Is(err, ErrVersionConflict) 为 true
+type VersionConflictError struct {
+	Key      string
+	Expected uint64 // 调用者期望的版本号
+	Current  uint64 // 当前的版本号
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("groupcache: version conflict on key[%v], expected %d, current %d",
+		e.Key, e.Expected, e.Current)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// VersionedGetter 是 Getter 可以选择实现的接口，用于提供数据源中的版本号（比如数据库中的行版本），
+// 返回 0 表示没有版本号，由 Group 分配。数据源的版本号不大于 Group 已经分配过的版本号时同样由 Group 分配，
+// 避免 Set 写入的值被淘汰后重新加载，版本号回到之前的值，持有旧版本号的 CompareAndSet 错误地成功
+type VersionedGetter interface {
+	Getter
+	GetVersioned(key string) (value []byte, version uint64, err error)
+}
+
+// GetVersion 与 GetContext 相同，同时返回值的版本号，用于之后的 CompareAndSet
+func (g *Group) GetVersion(ctx context.Context, key string) (*ByteView, uint64, error) {
+	val, err := g.GetContext(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, val.version, nil
+}
+
+// CompareAndSet 与 Set 相同，但负责该 key 的节点只有在当前版本号等于 expected 时才会写入，
+// 返回新的版本号。版本号不匹配时返回 *VersionConflictError。
+// key 不在缓存中时，会先通过 Getter 加载以得到当前的版本号
+func (g *Group) CompareAndSet(ctx context.Context, key string, expected uint64, value []byte) (uint64, error) {
+	return g.set(ctx, key, value, true, expected)
+}
+
+// nextVersion 分配一个新的版本号，新的版本号大于之前分配的所有版本号，并且不小于 min
+func (g *Group) nextVersion(min uint64) uint64 {
+	for {
+		cur := atomic.LoadUint64(&g.versionSeq)
+		next := cur + 1
+		if next < min {
+			next = min
+		}
+		if atomic.CompareAndSwapUint64(&g.versionSeq, cur, next) {
+			return next
+		}
+	}
+}
+
+// restoredVersion 返回从快照或者磁盘缓存恢复的值的版本号：沿用保存时的版本号，
+// 并保证之后分配的版本号都比它大，之前读到该版本号的 CompareAndSet 在重启后仍然有效。
+// 旧的格式没有保存版本号（saved 为 0），分配一个新的版本号
+func (g *Group) restoredVersion(saved uint64) uint64 {
+	if saved == 0 {
+		return g.nextVersion(0)
+	}
+	for {
+		cur := atomic.LoadUint64(&g.versionSeq)
+		if saved <= cur || atomic.CompareAndSwapUint64(&g.versionSeq, cur, saved) {
+			return saved
+		}
+	}
+}
+
+// loadedVersion 返回从数据源加载的值的版本号，supplied 为数据源提供的版本号，
+// 返回的版本号总是大于之前分配的所有版本号
+func (g *Group) loadedVersion(supplied uint64) uint64 {
+	for {
+		cur := atomic.LoadUint64(&g.versionSeq)
+		if supplied <= cur {
+			return g.nextVersion(0)
+		}
+		// 保证之后分配的版本号都比数据源提供的大
+		if atomic.CompareAndSwapUint64(&g.versionSeq, cur, supplied) {
+			return supplied
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"void.io/x/cache/diskcache"
+)
+
+// rowGetter 模拟带有行版本号的数据源
+type rowGetter struct{}
+
+func (rowGetter) Get(key string) ([]byte, error) {
+	return []byte("row"), nil
+}
+
+func (rowGetter) GetVersioned(key string) ([]byte, uint64, error) {
+	return []byte("row"), 10, nil
+}
+
+func TestCompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	group := NewGroup("cas", 1024, rowGetter{})
+	defer DeleteGroup("cas")
+
+	_, version, err := group.GetVersion(ctx, "a")
+	if err != nil || version != 10 {
+		t.Fatalf("want version supplied by getter, got %d, %v", version, err)
+	}
+	next, err := group.CompareAndSet(ctx, "a", version, []byte("v1"))
+	if err != nil || next <= version {
+		t.Fatalf("want a newer version, got %d, %v", next, err)
+	}
+
+	// 使用旧的版本号写入会失败
+	_, err = group.CompareAndSet(ctx, "a", version, []byte("v2"))
+	var conflict *VersionConflictError
+	if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &conflict) || conflict.Current != next {
+		t.Fatalf("want version conflict with current version %d, got %v", next, err)
+	}
+	if val, _ := group.Get("a"); val.String() != "v1" {
+		t.Fatalf("conflicting write should not be applied, got %v", val)
+	}
+
+	// Set 总是得到更大的版本号；key 不在缓存中时会先加载以得到当前的版本号
+	group.Set(ctx, "a", []byte("v3"))
+	if _, v, _ := group.GetVersion(ctx, "a"); v <= next {
+		t.Fatalf("Set should bump the version, got %d", v)
+	}
+	// 数据源的版本号不大于已经分配过的版本号时，分配新的版本号
+	_, err = group.CompareAndSet(ctx, "b", 10, []byte("v1"))
+	if !errors.As(err, &conflict) || conflict.Current <= next {
+		t.Fatalf("want a version newer than %d, got %v", next, err)
+	}
+	if _, err := group.CompareAndSet(ctx, "b", conflict.Current, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareAndSetAfterEviction(t *testing.T) {
+	ctx := context.Background()
+	group := NewRegistry().NewGroup("cas-evict", 1024, rowGetter{})
+	_, version, _ := group.GetVersion(ctx, "a")
+	if err := group.Set(ctx, "a", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set 写入的值被淘汰后重新加载，数据源的版本号不能让旧的版本号重新生效
+	group.mainCache.remove(cacheKey(0, "a"))
+	if _, err := group.CompareAndSet(ctx, "a", version, []byte("v2")); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale version should conflict after reload, got %v", err)
+	}
+}
+
+func TestCompareAndSetLoadsOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	loading, release := make(chan struct{}), make(chan struct{})
+	group := NewRegistry().NewGroup("cas-slow", 1024, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			close(loading)
+			<-release
+		}
+		return []byte(key), nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := group.CompareAndSet(ctx, "slow", 1, []byte("v1"))
+		done <- err
+	}()
+	<-loading
+	// 加载 slow 期间，其他 key 的写入不需要等待
+	if err := group.Set(ctx, "fast", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("want version conflict, got %v", err)
+	}
+}
+
+func TestCompareAndSetOnPeer(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v0"), nil
+	})
+	a, poolA, addrA := startNode(t, "cas-peer", getter)
+	_, poolB, addrB := startNode(t, "cas-peer", getter)
+	poolA.Set(addrA, addrB)
+	poolB.Set(addrA, addrB)
+	key := "k"
+	for i := 0; poolA.peers.Get(key) != addrB; i++ {
+		key = "k" + string(rune('a'+i))
+	}
+
+	ctx := context.Background()
+	_, version, err := a.GetVersion(ctx, key)
+	if err != nil || version == 0 {
+		t.Fatalf("want version from the owner, got %d, %v", version, err)
+	}
+	next, err := a.CompareAndSet(ctx, key, version, []byte("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.CompareAndSet(ctx, key, version, []byte("v2"))
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Current != next || conflict.Key != key {
+		t.Fatalf("want version conflict from the owner, got %v", err)
+	}
+	if val, v, _ := a.GetVersion(ctx, key); val.String() != "v1" || v != next {
+		t.Fatalf("want v1 at version %d, got %v at %d", next, val, v)
+	}
+}
+
+func TestCompareAndSetDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	loading, release := make(chan struct{}), make(chan struct{})
+	group := NewRegistry().NewGroup("cas-inflight", 1024, GetterFunc(func(key string) ([]byte, error) {
+		close(loading)
+		<-release
+		return []byte("old"), nil
+	}), WithExpiration(time.Hour), WithStaleWindow(time.Hour))
+
+	// 已经过期的值会触发后台刷新，刷新期间 CompareAndSet 成功
+	ck := cacheKey(0, "k")
+	group.mainCache.Add(ck, &ByteView{b: []byte("v0"), e: time.Now().Add(-time.Second), version: group.nextVersion(0)})
+	stale, version, err := group.GetVersion(ctx, "k")
+	if err != nil || !stale.Stale() {
+		t.Fatalf("want stale value, got %v, %v", stale, err)
+	}
+	<-loading
+	next, err := group.CompareAndSet(ctx, "k", version, []byte("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	// 刷新的结果被丢弃，写入的值和版本号保持不变
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if val, v, err := group.GetVersion(ctx, "k"); err != nil || val.String() != "v1" || v != next {
+			t.Fatalf("want v1 at version %d, got %v at %d, %v", next, val, v, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestVersionsPersisted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// open 模拟一次进程启动
+	open := func() (*Registry, *diskcache.Store, *Group) {
+		store, err := diskcache.Open(filepath.Join(dir, "disk"), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewRegistry()
+		return r, store, r.NewGroup("cas-persisted", 1<<10, rowGetter{}, WithSnapshotDir(dir), WithDiskTier(store))
+	}
+
+	r, store, g := open()
+	g.Set(ctx, "a", []byte("v1"))
+	g.Set(ctx, "b", []byte("v1"))
+	_, va, _ := g.GetVersion(ctx, "a")
+	vb, _ := g.mainCache.peek(cacheKey(0, "b"))
+	// b 只保存在磁盘缓存中
+	g.spillToDisk(cacheKey(0, "b"), vb)
+	g.mainCache.remove(cacheKey(0, "b"))
+	r.Shutdown()
+	store.Close()
+
+	// 重启后快照和磁盘缓存中的值保留原来的版本号，新的版本号比它们都大
+	r, store, g = open()
+	defer store.Close()
+	defer r.Shutdown()
+	if _, v, _ := g.GetVersion(ctx, "a"); v != va {
+		t.Fatalf("version should survive snapshots, want %d, got %d", va, v)
+	}
+	if _, v, _ := g.GetVersion(ctx, "b"); v != vb.version {
+		t.Fatalf("version should survive the disk tier, want %d, got %d", vb.version, v)
+	}
+	next, err := g.CompareAndSet(ctx, "a", va, []byte("v2"))
+	if err != nil || next <= vb.version {
+		t.Fatalf("want a version newer than restored ones, got %d, %v", next, err)
+	}
+
+	// 旧的磁盘格式没有版本号
+	if val, err := decodeDiskValue([]byte("\x00old")); err != nil || val.String() != "old" || val.version != 0 {
+		t.Fatalf("want the old disk format decoded, got %v, %v", val, err)
+	}
+}